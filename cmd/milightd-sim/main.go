@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/sgrzywna/milightd/internal/app/milightd"
+	"github.com/sgrzywna/milightd/internal/pkg/simulator"
+)
+
+func main() {
+	var host = flag.String("host", "", "listening address")
+	var port = flag.Int("port", milightd.DefaultBridgePort, "listening port")
+	var bulb = flag.String("bulb", milightd.BulbRGBWW, "bulb type paired with zones (ibox, rgbw, rgbww, cct)")
+	var zones = flag.String("zones", "", "bulb types paired with given zones, e.g. 2=cct,4=rgbw")
+	var httpAddr = flag.String("http", ":8081", "address of HTTP server reporting bulbs state, empty disables it")
+
+	flag.Parse()
+
+	zoneBulbs, err := parseZones(*zones)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	profile, err := milightd.NewProfile(milightd.ProtocolV6, *bulb, zoneBulbs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sim, err := simulator.Listen(net.JoinHostPort(*host, strconv.Itoa(*port)), profile.Devices())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sim.Close()
+
+	log.Printf("milightd-sim listening @ %s", sim.Addr())
+
+	if *httpAddr != "" {
+		http.HandleFunc("/bulbs", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			err := json.NewEncoder(w).Encode(sim.Bulbs())
+			if err != nil {
+				http.Error(w, "milightd-sim error", http.StatusInternalServerError)
+			}
+		})
+		go func() {
+			log.Printf("milightd-sim bulbs state @ http://%s/bulbs", *httpAddr)
+			log.Fatal(http.ListenAndServe(*httpAddr, nil))
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+}
+
+// parseZones parses list of zone=bulb pairs.
+func parseZones(s string) (map[int]string, error) {
+	zones := make(map[int]string)
+	if s == "" {
+		return zones, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid zone %s", pair)
+		}
+		zone, err := strconv.Atoi(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zone %s", pair)
+		}
+		zones[zone] = strings.TrimSpace(kv[1])
+	}
+	return zones, nil
+}
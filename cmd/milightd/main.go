@@ -22,14 +22,64 @@ func main() {
 	defaultStoreFolder := filepath.Join(filepath.Dir(exePath), defaultStoreFolderName)
 
 	var mihost = flag.String("mihost", "", "Mi-Light network address")
-	var miport = flag.Int("miport", 5987, "Mi-Light network port")
+	var miport = flag.Int("miport", 0, "Mi-Light network port (default 5987, 8899 for legacy protocol)")
+	var miprotocol = flag.String("miprotocol", milightd.ProtocolV6, "Mi-Light bridge protocol (v6, legacy)")
+	var mibulb = flag.String("mibulb", "", "Mi-Light bulb type (ibox, rgbw, rgbww, cct) (default ibox, rgbw for legacy protocol)")
+	var linkWindow = flag.Int("linkwindow", milightd.DefaultLinkWindow, "pairing window in milliseconds")
+	var queueSize = flag.Int("queuesize", milightd.DefaultQueueSize, "number of commands waiting for execution")
+	var queueTimeout = flag.Int("queuetimeout", milightd.DefaultQueueTimeout, "time in milliseconds command waits for free place in the full queue")
+	var retryAttempts = flag.Int("retryattempts", milightd.DefaultRetryAttempts, "maximal number of command execution attempts")
+	var retryBackoff = flag.Int("retrybackoff", milightd.DefaultRetryBackoff, "delay in milliseconds before the first retry, doubled for every next one")
+	var retryMaxBackoff = flag.Int("retrymaxbackoff", milightd.DefaultRetryMaxBackoff, "longest delay in milliseconds between retries")
+	var commandDeadline = flag.Int("deadline", milightd.DefaultCommandDeadline, "longest time in milliseconds since command was queued until its execution")
+	var breakerThreshold = flag.Int("breakerthreshold", milightd.DefaultBreakerThreshold, "number of consecutive connection failures stopping commands")
+	var breakerCooldown = flag.Int("breakercooldown", milightd.DefaultBreakerCooldown, "time in milliseconds commands are stopped before probing the bridge")
+	var readyWindow = flag.Int("readywindow", milightd.DefaultReadyWindow, "time in milliseconds bridge counts as reachable since the last successful connection")
+	var fadeRate = flag.Int("faderate", milightd.DefaultFadeRate, "number of intermediate commands per second sent during sequence step transition")
+	var reconcile = flag.Int("reconcile", 0, "period of re-sending the last light state in milliseconds, disabled when 0")
+	var restore = flag.String("restore", milightd.RestoreNone, "light state restored on startup (none, last, default)")
+	var restoreDefault = flag.String("restoredefault", "", "name of the sequence started on startup with default restore policy")
+	var configFile = flag.String("config", "", "configuration file with Mi-Light bridges")
 	var port = flag.Int("port", 8080, "listening port")
 	var storeDir = flag.String("store", defaultStoreFolder, "store folder")
 	var enableProfiling = flag.Bool("pprof", false, "enable profiling")
 
 	flag.Parse()
 
-	m, err := milightd.NewMilightController(*mihost, *miport, *storeDir)
+	cfg := &milightd.Config{
+		Bridges: []milightd.BridgeConfig{
+			{
+				Name:              milightd.DefaultBridgeName,
+				Host:              *mihost,
+				Port:              *miport,
+				Protocol:          *miprotocol,
+				Bulb:              *mibulb,
+				LinkWindow:        *linkWindow,
+				QueueSize:         *queueSize,
+				QueueTimeout:      *queueTimeout,
+				RetryAttempts:     *retryAttempts,
+				RetryBackoff:      *retryBackoff,
+				RetryMaxBackoff:   *retryMaxBackoff,
+				CommandDeadline:   *commandDeadline,
+				BreakerThreshold:  *breakerThreshold,
+				BreakerCooldown:   *breakerCooldown,
+				ReadyWindow:       *readyWindow,
+				FadeRate:          *fadeRate,
+				ReconcileInterval: *reconcile,
+				Restore:           *restore,
+				RestoreDefault:    *restoreDefault,
+			},
+		},
+	}
+
+	if *configFile != "" {
+		cfg, err = milightd.LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	m, err := milightd.NewMilightController(cfg.Bridges, *storeDir)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,114 @@
+package milightd
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+var (
+	// errCircuitOpen is returned when bridge connection isn't tried because of the recent failures.
+	errCircuitOpen = errors.New("circuit breaker open")
+)
+
+// CircuitBreaker stops connecting to the bridge after consecutive connection failures.
+//
+// Breaker opens after threshold consecutive failures and fails fast until the cooldown is over.
+// Then it is half-open and lets single probe through: success closes it, failure opens it again.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	changed   time.Time
+	probing   bool
+	mux       sync.Mutex
+}
+
+// NewCircuitBreaker returns initialized closed CircuitBreaker object.
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     models.CircuitClosed,
+		changed:   time.Now(),
+	}
+}
+
+// Allow checks whether bridge connection can be tried, open breaker lets single probe through after the cooldown.
+func (c *CircuitBreaker) Allow() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.state == models.CircuitOpen && time.Since(c.changed) >= c.cooldown {
+		c.setState(models.CircuitHalfOpen)
+	}
+
+	switch {
+	case c.state == models.CircuitClosed:
+		return nil
+	case c.state == models.CircuitHalfOpen && !c.probing:
+		c.probing = true
+		return nil
+	}
+
+	return errCircuitOpen
+}
+
+// Available checks whether commands can be sent to the bridge, without letting probe through.
+func (c *CircuitBreaker) Available() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.state == models.CircuitOpen && time.Since(c.changed) < c.cooldown {
+		return errCircuitOpen
+	}
+	return nil
+}
+
+// Success records successful bridge connection.
+func (c *CircuitBreaker) Success() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.failures = 0
+	c.probing = false
+	if c.state != models.CircuitClosed {
+		c.setState(models.CircuitClosed)
+	}
+}
+
+// Failure records bridge connection failure.
+func (c *CircuitBreaker) Failure() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.failures++
+	c.probing = false
+	if c.state == models.CircuitHalfOpen || c.state == models.CircuitClosed && c.failures >= c.threshold {
+		c.setState(models.CircuitOpen)
+	} else if c.state == models.CircuitOpen {
+		// failure of the connection allowed before the breaker opened
+		c.changed = time.Now()
+	}
+}
+
+// Status returns breaker state.
+func (c *CircuitBreaker) Status() models.Circuit {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return models.Circuit{
+		State:    c.state,
+		Failures: c.failures,
+		Changed:  c.changed,
+	}
+}
+
+// setState changes breaker state.
+func (c *CircuitBreaker) setState(state string) {
+	log.Printf("milight %s circuit breaker %s -> %s after %d failures", c.name, c.state, state, c.failures)
+	c.state = state
+	c.changed = time.Now()
+}
@@ -0,0 +1,95 @@
+package milightd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	c := NewCircuitBreaker(DefaultBridgeName, 2, 50*time.Millisecond)
+
+	c.Failure()
+
+	if err := c.Allow(); err != nil {
+		t.Fatalf("expected closed breaker, got %v", err)
+	}
+
+	c.Failure()
+
+	if state := c.Status().State; state != models.CircuitOpen {
+		t.Fatalf("expected %s, got %s", models.CircuitOpen, state)
+	}
+	if err := c.Allow(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("expected %v, got %v", errCircuitOpen, err)
+	}
+	if err := c.Available(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("expected %v, got %v", errCircuitOpen, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if err := c.Allow(); err != nil {
+		t.Fatalf("expected probe allowed, got %v", err)
+	}
+	if state := c.Status().State; state != models.CircuitHalfOpen {
+		t.Fatalf("expected %s, got %s", models.CircuitHalfOpen, state)
+	}
+	if err := c.Allow(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("expected single probe, got %v", err)
+	}
+
+	c.Failure()
+
+	if state := c.Status().State; state != models.CircuitOpen {
+		t.Fatalf("expected %s after failed probe, got %s", models.CircuitOpen, state)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if err := c.Allow(); err != nil {
+		t.Fatalf("expected probe allowed, got %v", err)
+	}
+
+	c.Success()
+
+	if status := c.Status(); status.State != models.CircuitClosed || status.Failures != 0 {
+		t.Errorf("expected %s without failures, got %+v", models.CircuitClosed, status)
+	}
+}
+
+func TestBridgeCircuitBreaker(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	host, port := testSimulatorAddr(t, sim)
+	sim.Close()
+
+	cfg := BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port, RetryAttempts: 1, BreakerThreshold: 2, BreakerCooldown: 60000}
+
+	b := NewBridge(cfg, profile)
+	defer b.Close()
+
+	l := models.Light{}
+	l.SetZone(1)
+	l.SetSwitch(true)
+
+	for i := 0; i < 2; i++ {
+		err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+		if !errors.Is(err, ErrBridgeUnavailable) {
+			t.Fatalf("expected %v, got %v", ErrBridgeUnavailable, err)
+		}
+	}
+
+	if state := b.Status().Circuit.State; state != models.CircuitOpen {
+		t.Fatalf("expected %s, got %s", models.CircuitOpen, state)
+	}
+
+	err := b.Process(context.Background(), PriorityInteractive, l)
+	if !errors.Is(err, ErrBridgeUnavailable) {
+		t.Errorf("expected %v without queueing, got %v", ErrBridgeUnavailable, err)
+	}
+}
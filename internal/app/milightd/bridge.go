@@ -0,0 +1,654 @@
+package milightd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+const (
+	// connectionTTL is the Mi-Light connection time to live.
+	connectionTTL = 30 * time.Second
+	// syncTimeout is the longest time synchronous command waits for execution.
+	syncTimeout = 10 * time.Second
+	// maxLinkWindow is the longest pairing window, commands loop is blocked for its duration.
+	maxLinkWindow = 30 * time.Second
+)
+
+// job represents command queued for execution, done receives execution result when set.
+type job struct {
+	cmd      Command
+	done     chan error
+	deadline time.Time
+}
+
+// commandList represents commands executed one by one until the first error.
+type commandList []Command
+
+// Exec executes commands.
+func (l commandList) Exec(lc LightController) error {
+	for _, c := range l {
+		err := c.Exec(lc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String implements string representation of the commands.
+func (l commandList) String() string {
+	s := make([]string, len(l))
+	for i, c := range l {
+		s[i] = fmt.Sprint(c)
+	}
+	return strings.Join(s, ", ")
+}
+
+// Bridge controls single Mi-Light bridge with its own connection, commands loop and sequencer.
+type Bridge struct {
+	name        string
+	restore     string
+	restoreDef  string
+	profile     *Profile
+	linkWindow  time.Duration
+	timeout     time.Duration
+	retry       retryPolicy
+	cmds        *commandQueue
+	sequencer   Sequencer
+	connkeeper  *ConnectionKeeper
+	breaker     *CircuitBreaker
+	state       *StateTracker
+	reconciler  *Reconciler
+	sequences   SequenceStorer
+	failed      deadLetters
+	readyWindow time.Duration
+	mutex       sync.Mutex
+	busySince   time.Time
+	closed      chan struct{}
+	loopDone    chan struct{}
+}
+
+// NewBridge returns initialized Bridge object.
+func NewBridge(cfg BridgeConfig, profile *Profile) *Bridge {
+	connman := NewConnectionManager(cfg.Protocol, cfg.Host, cfg.Port, profile.Devices())
+	breaker := NewCircuitBreaker(cfg.Name, orDefault(cfg.BreakerThreshold, DefaultBreakerThreshold),
+		time.Duration(orDefault(cfg.BreakerCooldown, DefaultBreakerCooldown))*time.Millisecond)
+	readyWindow := time.Duration(orDefault(cfg.ReadyWindow, DefaultReadyWindow)) * time.Millisecond
+	connkeeper := NewConnectionKeeper(connman, connectionTTL, readyWindow/2, breaker)
+	linkWindow := orDefault(cfg.LinkWindow, DefaultLinkWindow)
+	timeout := orDefault(cfg.QueueTimeout, DefaultQueueTimeout)
+	retry := retryPolicy{
+		attempts:   orDefault(cfg.RetryAttempts, DefaultRetryAttempts),
+		backoff:    time.Duration(orDefault(cfg.RetryBackoff, DefaultRetryBackoff)) * time.Millisecond,
+		maxBackoff: time.Duration(orDefault(cfg.RetryMaxBackoff, DefaultRetryMaxBackoff)) * time.Millisecond,
+		deadline:   time.Duration(orDefault(cfg.CommandDeadline, DefaultCommandDeadline)) * time.Millisecond,
+	}
+	b := Bridge{
+		name:        cfg.Name,
+		restore:     cfg.Restore,
+		restoreDef:  cfg.RestoreDefault,
+		profile:     profile,
+		linkWindow:  time.Duration(linkWindow) * time.Millisecond,
+		timeout:     time.Duration(timeout) * time.Millisecond,
+		retry:       retry,
+		cmds:        newCommandQueue(orDefault(cfg.QueueSize, DefaultQueueSize)),
+		connkeeper:  connkeeper,
+		breaker:     breaker,
+		state:       NewStateTracker(cfg.Name, profile),
+		readyWindow: readyWindow,
+		closed:      make(chan struct{}),
+		loopDone:    make(chan struct{}),
+	}
+	b.sequencer = NewSequenceProcessor(&b, time.Second/time.Duration(orDefault(cfg.FadeRate, DefaultFadeRate)))
+	if cfg.ReconcileInterval > 0 {
+		b.reconciler = NewReconciler(&b, time.Duration(cfg.ReconcileInterval)*time.Millisecond, connman.Reconnected())
+	}
+	go b.loop()
+	return &b
+}
+
+// orDefault returns value or the default one when value isn't set.
+func orDefault(value, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// Name returns bridge name.
+func (b *Bridge) Name() string {
+	return b.name
+}
+
+// State returns state of the light in zones paired with the bridge.
+func (b *Bridge) State() []models.LightState {
+	return b.state.State()
+}
+
+// Status returns status of the bridge connection.
+func (b *Bridge) Status() models.BridgeStatus {
+	return models.BridgeStatus{
+		Bridge:  b.name,
+		Circuit: b.breaker.Status(),
+	}
+}
+
+// FailedCommands returns the latest commands never executed by the bridge.
+func (b *Bridge) FailedCommands() []models.FailedCommand {
+	return b.failed.list()
+}
+
+// Devices returns description of the bulbs paired with the bridge zones.
+func (b *Bridge) Devices() []models.Device {
+	var devices []models.Device
+	for zone := models.ZoneAll + 1; zone <= models.MaxZone; zone++ {
+		devices = append(devices, models.Device{
+			Bridge:       b.name,
+			Zone:         zone,
+			Bulb:         b.profile.Bulb(zone),
+			Capabilities: b.profile.Capabilities(zone),
+		})
+	}
+	return devices
+}
+
+// Close terminates bridge.
+func (b *Bridge) Close() {
+	b.sequencer.Stop()
+	if b.reconciler != nil {
+		b.reconciler.Terminate()
+	}
+	close(b.closed)
+	b.cmds.close()
+	// pending jobs are executed before the connection and state tracker are closed
+	<-b.loopDone
+	b.connkeeper.Terminate()
+	b.state.Close()
+}
+
+// Restore restores light state saved in store and applies restore policy.
+// Sequence store is kept for sequences chained after the completed ones.
+func (b *Bridge) Restore(states StateStorer, sequences SequenceStorer) error {
+	saved, err := states.Load(b.name)
+	if err != nil {
+		return err
+	}
+
+	b.sequences = sequences
+
+	b.state.Persist(states, saved)
+
+	switch b.restore {
+	case RestoreLast:
+		go b.restoreLast(saved)
+	case RestoreDefault:
+		seq, err := sequences.Get(b.restoreDef)
+		if err != nil {
+			log.Printf("milightd %s can't restore default %s: %s", b.name, b.restoreDef, err)
+			return nil
+		}
+		log.Printf("milightd %s restore default %s", b.name, seq.Name)
+		b.sequencer.Start(seq)
+	}
+
+	return nil
+}
+
+// Pending returns number of commands waiting for execution with the given priority and the limit of such commands.
+func (b *Bridge) Pending(p Priority) (int, int) {
+	return b.cmds.usage(p)
+}
+
+// GetSequence returns sequence definition from the sequence store.
+func (b *Bridge) GetSequence(name string) (*models.Sequence, error) {
+	if b.sequences == nil {
+		return nil, fmt.Errorf("sequence %s: no sequence store", name)
+	}
+	return b.sequences.Get(name)
+}
+
+// restoreLast sends the last commanded light state to zones.
+func (b *Bridge) restoreLast(states []models.LightState) {
+	for _, state := range states {
+		l := lightFromState(state)
+		if l.Switch == nil && l.Color == nil && l.Hue == nil && l.Brightness == nil {
+			continue
+		}
+		log.Printf("milightd %s restore %s", b.name, l.String())
+		err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+		if err != nil {
+			log.Printf("milightd %s can't restore zone %d: %s", b.name, l.Zone, err)
+		}
+	}
+}
+
+// lightFromState returns light control command setting the light state, switched off light is only switched off.
+// Night light is only switched on too, color and brightness commands would end it.
+func lightFromState(state models.LightState) models.Light {
+	l := models.Light{Zone: state.Zone}
+	l.Switch = state.Switch
+	if state.Switch != nil && (*state.Switch == models.Off || *state.Switch == models.Night) {
+		return l
+	}
+	l.Color = state.Color
+	if l.Color == nil {
+		l.Hue = state.Hue
+	}
+	l.Brightness = state.Brightness
+	return l
+}
+
+// Process processes light control command with the given priority, interactive command stops the running sequence.
+// Commands wait for free place in the full queue until queue timeout or until the context is done.
+func (b *Bridge) Process(ctx context.Context, p Priority, l models.Light) error {
+	cmds, err := b.commands(l)
+	if err != nil {
+		return err
+	}
+
+	if p == PriorityInteractive {
+		b.sequencer.Stop()
+	}
+
+	for _, c := range cmds {
+		log.Printf("milightd %s %s", b.name, c)
+		err = b.exec(ctx, p, c)
+		if err != nil {
+			log.Printf("milightd %s %s failed: %s", b.name, c, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Link pairs or unpairs bulbs with the zone, link sequence is sent for the duration given in milliseconds.
+func (b *Bridge) Link(zone int, duration int, unlink bool) error {
+	if zone <= models.ZoneAll || zone > models.MaxZone {
+		return ErrInvalidZone
+	}
+
+	window := b.linkWindow
+	if duration != 0 {
+		window = time.Duration(duration) * time.Millisecond
+	}
+	if window <= 0 || window > maxLinkWindow {
+		return fmt.Errorf("%w: duration %d out of range", ErrInvalidValue, duration)
+	}
+
+	if !b.profile.Capabilities(zone).Link {
+		return b.unsupported(zone, "pairing")
+	}
+
+	b.sequencer.Stop()
+
+	c := &ZoneLink{zone: byte(zone), unlink: unlink, window: window}
+
+	log.Printf("milightd %s %s", b.name, c)
+	err := b.exec(context.Background(), PriorityInteractive, c)
+	if err != nil {
+		log.Printf("milightd %s %s failed: %s", b.name, c, err)
+		return err
+	}
+
+	return nil
+}
+
+// ProcessSync processes light control command with the given priority and waits for its execution or until the context is done.
+func (b *Bridge) ProcessSync(ctx context.Context, p Priority, l models.Light) error {
+	cmds, err := b.commands(l)
+	if err != nil {
+		return err
+	}
+
+	if p == PriorityInteractive {
+		b.sequencer.Stop()
+	}
+
+	c := commandList(cmds)
+	done := make(chan error, 1)
+
+	log.Printf("milightd %s %s", b.name, c)
+	err = b.enqueue(ctx, p, job{cmd: c, done: done})
+	if err != nil {
+		log.Printf("milightd %s %s failed: %s", b.name, c, err)
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return deviceError(err)
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s", ErrBridgeTimeout, ctx.Err())
+	case <-time.After(syncTimeout):
+		return fmt.Errorf("%w: command not executed within %s", ErrBridgeTimeout, syncTimeout)
+	}
+}
+
+// deviceError translates command execution error into error reported to the caller.
+func deviceError(err error) error {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %s", ErrBridgeTimeout, err)
+	case errors.Is(err, errCommandExpired):
+		return fmt.Errorf("%w: %s", ErrBridgeTimeout, err)
+	case errors.Is(err, errCircuitOpen), errors.Is(err, errAllocateConnection), errors.Is(err, milight.ErrInvalidResponse), errors.As(err, &netErr):
+		return fmt.Errorf("%w: %s", ErrBridgeUnavailable, err)
+	}
+	return err
+}
+
+// commands validates light control command and translates it into Mi-Light commands.
+func (b *Bridge) commands(l models.Light) ([]Command, error) {
+	if l.Zone < models.ZoneAll || l.Zone > models.MaxZone {
+		return nil, ErrInvalidZone
+	}
+
+	if l.Color != nil && l.Hue != nil {
+		return nil, fmt.Errorf("%w: color and hue are mutually exclusive", ErrInvalidColor)
+	}
+
+	if l.Hue != nil && (*l.Hue < 0 || *l.Hue > models.MaxHue) {
+		return nil, fmt.Errorf("%w: hue %d out of range", ErrInvalidColor, *l.Hue)
+	}
+
+	if l.Saturation != nil && (*l.Saturation < 0 || *l.Saturation > models.MaxSaturation) {
+		return nil, fmt.Errorf("%w: saturation %d out of range", ErrInvalidValue, *l.Saturation)
+	}
+
+	if l.Kelvin != nil && *l.Kelvin <= 0 {
+		return nil, fmt.Errorf("%w: kelvin %d out of range", ErrInvalidValue, *l.Kelvin)
+	}
+
+	if l.Mode != nil && (*l.Mode < models.MinMode || *l.Mode > models.MaxMode) {
+		return nil, fmt.Errorf("%w: mode %d out of range", ErrInvalidValue, *l.Mode)
+	}
+
+	if l.Speed != nil && *l.Speed != models.SpeedUp && *l.Speed != models.SpeedDown {
+		return nil, fmt.Errorf("%w: speed %s", ErrInvalidValue, *l.Speed)
+	}
+
+	caps := b.profile.Capabilities(l.Zone)
+	zone := byte(l.Zone)
+	brightness := l.Brightness
+
+	var cmds []Command
+
+	if l.Switch != nil {
+		if *l.Switch == models.Night && !caps.Night {
+			return nil, b.unsupported(l.Zone, "night light")
+		}
+		cmds = append(cmds, &LightSwitch{zone: zone, on: *l.Switch})
+	}
+
+	if l.Color != nil {
+		setting, err := parseColor(*l.Color)
+		if err != nil {
+			return nil, err
+		}
+		if !setting.white && !caps.Color {
+			return nil, b.unsupported(l.Zone, "color")
+		}
+		if setting.white && !caps.White && !caps.Kelvin {
+			return nil, b.unsupported(l.Zone, "white light")
+		}
+		if brightness == nil {
+			brightness = setting.brightness
+		}
+		// dual white bulbs always emit white light
+		if !setting.white || caps.White {
+			cmds = append(cmds, &LightColor{zone: zone, color: *l.Color})
+		}
+	}
+
+	if l.Hue != nil {
+		if !caps.Color {
+			return nil, b.unsupported(l.Zone, "color")
+		}
+		cmds = append(cmds, &LightHue{zone: zone, hue: byte(*l.Hue)})
+	}
+
+	if l.Saturation != nil {
+		if !caps.Saturation {
+			return nil, b.unsupported(l.Zone, "saturation")
+		}
+		cmds = append(cmds, &LightSaturation{zone: zone, level: *l.Saturation})
+	}
+
+	if l.Kelvin != nil {
+		if !caps.Kelvin {
+			return nil, b.unsupported(l.Zone, "kelvin")
+		}
+		cmds = append(cmds, &LightTemperature{zone: zone, kelvin: *l.Kelvin})
+	}
+
+	if l.Mode != nil {
+		if !caps.Modes {
+			return nil, b.unsupported(l.Zone, "mode")
+		}
+		cmds = append(cmds, &LightMode{zone: zone, mode: *l.Mode})
+	}
+
+	if l.Speed != nil {
+		if !caps.Modes {
+			return nil, b.unsupported(l.Zone, "speed")
+		}
+		cmds = append(cmds, &LightSpeed{zone: zone, speed: *l.Speed})
+	}
+
+	if brightness != nil {
+		cmds = append(cmds, &LightBrightness{zone: zone, level: *brightness})
+	}
+
+	return cmds, nil
+}
+
+// unsupported returns error describing feature not supported by the bulbs paired with the zone.
+func (b *Bridge) unsupported(zone int, feature string) error {
+	if zone == models.ZoneAll {
+		return fmt.Errorf("%w: %s not supported by any bulb", ErrUnsupportedFeature, feature)
+	}
+	return fmt.Errorf("%w: %s not supported by %s bulb in zone %d", ErrUnsupportedFeature, feature, b.profile.Bulb(zone), zone)
+}
+
+// exec executes command with the given priority.
+func (b *Bridge) exec(ctx context.Context, p Priority, c Command) error {
+	return b.enqueue(ctx, p, job{cmd: c})
+}
+
+// enqueue queues job for execution with the given priority, waiting for free place in the full queue until queue timeout.
+// It fails fast when the bridge circuit breaker is open.
+func (b *Bridge) enqueue(ctx context.Context, p Priority, j job) error {
+	if err := b.breaker.Available(); err != nil {
+		return fmt.Errorf("%w: %s", ErrBridgeUnavailable, err)
+	}
+	j.deadline = time.Now().Add(b.retry.deadline)
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	return b.cmds.push(ctx, p, j)
+}
+
+// loop is the main processing loop, it returns when the queue is closed and drained.
+func (b *Bridge) loop() {
+	log.Printf("milight %s controller loop started", b.name)
+	defer log.Printf("milight %s controller loop terminated", b.name)
+	defer close(b.loopDone)
+
+	for {
+		j, ok := b.cmds.pop()
+		if !ok {
+			return
+		}
+		b.setBusy(time.Now())
+		err := b.processJob(j)
+		b.setBusy(time.Time{})
+		if j.done != nil {
+			j.done <- err
+		}
+	}
+}
+
+// setBusy records start of the job execution, zero time means the loop waits for the next job.
+func (b *Bridge) setBusy(t time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.busySince = t
+}
+
+// Ready returns readiness checks of the bridge connection and commands loop.
+func (b *Bridge) Ready() []models.Check {
+	return []models.Check{b.checkConnection(), b.checkLoop()}
+}
+
+// checkConnection checks whether bridge was reached within ready window and its circuit breaker isn't open.
+func (b *Bridge) checkConnection() models.Check {
+	c := models.Check{Name: models.CheckBridge, Bridge: b.name, Status: models.HealthFailed}
+	circuit := b.breaker.Status()
+	contact, verified := b.connkeeper.LastContact()
+	switch {
+	case circuit.State == models.CircuitOpen:
+		c.Detail = fmt.Sprintf("circuit breaker open after %d failures", circuit.Failures)
+	case !verified:
+		c.Status = models.HealthOK
+		c.Detail = "legacy bridge doesn't respond to commands, reachability can't be verified"
+	case contact.IsZero():
+		c.Detail = "bridge not reached yet"
+	case time.Since(contact) > b.readyWindow:
+		c.Detail = fmt.Sprintf("bridge not reached since %s", contact.Format(time.RFC3339))
+	default:
+		c.Status = models.HealthOK
+		c.Detail = fmt.Sprintf("bridge reached at %s", contact.Format(time.RFC3339))
+	}
+	return c
+}
+
+// checkLoop checks whether commands loop doesn't execute single job longer than the job can take.
+// Job is retried until its deadline, the last attempt can block the loop for the longest pairing window.
+func (b *Bridge) checkLoop() models.Check {
+	c := models.Check{Name: models.CheckLoop, Bridge: b.name, Status: models.HealthOK}
+	b.mutex.Lock()
+	busySince := b.busySince
+	b.mutex.Unlock()
+	if busySince.IsZero() {
+		c.Detail = "waiting for commands"
+		return c
+	}
+	busy := time.Since(busySince).Round(time.Millisecond)
+	c.Detail = fmt.Sprintf("executing command for %s", busy)
+	if busy > b.retry.deadline+maxLinkWindow {
+		c.Status = models.HealthFailed
+		c.Detail = fmt.Sprintf("command stuck for %s", busy)
+	}
+	return c
+}
+
+// processJob executes job commands, retrying them with backoff after bridge connection failures.
+// Commands not executed before the job deadline or within allowed attempts are added to the failed commands.
+func (b *Bridge) processJob(j job) error {
+	cmds := commandList{j.cmd}
+	switch c := j.cmd.(type) {
+	case commandList:
+		cmds = c
+	case reconcileCommand:
+		// light state is read when the job is executed, not when it's queued
+		cmds = c.r.commands()
+		if len(cmds) == 0 {
+			return nil
+		}
+	}
+
+	deadline := j.deadline
+	if deadline.IsZero() {
+		deadline = time.Now().Add(b.retry.deadline)
+	}
+
+	var err error
+
+	attempt := 0
+
+	for {
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = errCommandExpired
+			} else {
+				err = fmt.Errorf("%w: %s", errCommandExpired, err)
+			}
+			break
+		}
+		attempt++
+		cmds, err = b.processCommands(cmds)
+		if err == nil {
+			return nil
+		}
+		if !retryable(err) || attempt >= b.retry.attempts {
+			break
+		}
+		delay := b.retry.delay(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			break
+		}
+		log.Printf("milight %s command error: %s, retry in %s", b.name, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-b.closed:
+			return err
+		}
+	}
+
+	log.Printf("milight %s command %s failed after %d attempts: %s", b.name, cmds, attempt, err)
+
+	b.failed.add(models.FailedCommand{
+		Bridge:   b.name,
+		Command:  cmds.String(),
+		Attempts: attempt,
+		Error:    err.Error(),
+		Time:     time.Now(),
+	})
+
+	return err
+}
+
+// processCommands allocates connection to Mi-Light device, executes commands and records light state.
+// It returns commands not executed because of the error, starting with the failed one.
+func (b *Bridge) processCommands(cmds commandList) (commandList, error) {
+	ml, err := b.connkeeper.Allocate()
+	if errors.Is(err, errCircuitOpen) {
+		for _, c := range cmds {
+			b.state.Record(c, err)
+		}
+		return cmds, err
+	}
+	if err != nil {
+		log.Printf("can't allocate milight %s device: %s", b.name, err)
+		err = fmt.Errorf("%w: %s", errAllocateConnection, err)
+		for _, c := range cmds {
+			b.state.Record(c, err)
+		}
+		return cmds, err
+	}
+	defer b.connkeeper.Release()
+	for i, c := range cmds {
+		err = c.Exec(ml)
+		b.state.Record(c, err)
+		if err != nil {
+			if retryable(err) {
+				// next attempt starts with the new session
+				b.connkeeper.Reset()
+			}
+			return cmds[i:], err
+		}
+	}
+	return nil, nil
+}
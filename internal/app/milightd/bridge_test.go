@@ -0,0 +1,224 @@
+package milightd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestBridgeCommands(t *testing.T) {
+	b := Bridge{name: DefaultBridgeName, profile: testProfile(t, BulbRGBWW, nil)}
+
+	l := models.Light{}
+	l.SetZone(2)
+	l.SetSwitch(true)
+	l.SetColor("#000080")
+	l.SetSaturation(50)
+	l.SetKelvin(4000)
+	l.SetMode(3)
+	l.SetSpeed(false)
+
+	cmds, err := b.commands(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"zone 2 light switch on",
+		"zone 2 color #000080",
+		"zone 2 saturation 50",
+		"zone 2 kelvin 4000",
+		"zone 2 mode 3",
+		"zone 2 speed down",
+		"zone 2 brightness 32",
+	}
+
+	if len(cmds) != len(expected) {
+		t.Fatalf("expected %d commands, got %d", len(expected), len(cmds))
+	}
+
+	for i, c := range cmds {
+		if c.(fmt.Stringer).String() != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], c)
+		}
+	}
+}
+
+func TestBridgeCommandsUnsupportedFeature(t *testing.T) {
+	cases := []struct {
+		bulb  string
+		light models.Light
+	}{
+		{BulbRGBW, models.Light{}},
+		{BulbRGBW, models.Light{}},
+		{BulbCCT, models.Light{}},
+		{BulbCCT, models.Light{}},
+		{BulbCCT, models.Light{}},
+		{BulbCCT, models.Light{}},
+		{BulbBridgeLamp, models.Light{}},
+	}
+	cases[0].light.SetKelvin(3000)
+	cases[1].light.SetSaturation(10)
+	cases[2].light.SetColor("red")
+	cases[3].light.SetHue(10)
+	cases[4].light.SetMode(1)
+	cases[5].light.SetSpeed(true)
+	cases[6].light.SetNight()
+
+	for _, tc := range cases {
+		b := Bridge{name: DefaultBridgeName, profile: testProfile(t, tc.bulb, nil)}
+		_, err := b.commands(tc.light)
+		if !errors.Is(err, ErrUnsupportedFeature) {
+			t.Errorf("%s %s: expected %v, got %v", tc.bulb, tc.light.String(), ErrUnsupportedFeature, err)
+		}
+	}
+}
+
+func TestBridgeCommandsInvalidValue(t *testing.T) {
+	cases := []models.Light{{}, {}, {}, {}, {}, {}}
+	cases[0].SetKelvin(0)
+	cases[1].SetSaturation(-1)
+	cases[2].SetSaturation(models.MaxSaturation + 1)
+	cases[3].SetMode(models.MinMode - 1)
+	cases[4].SetMode(models.MaxMode + 1)
+	cases[5].Speed = new(string)
+	*cases[5].Speed = "fast"
+
+	b := Bridge{name: DefaultBridgeName, profile: testProfile(t, BulbRGBWW, nil)}
+
+	for _, tc := range cases {
+		_, err := b.commands(tc)
+		if !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%s: expected %v, got %v", tc.String(), ErrInvalidValue, err)
+		}
+	}
+}
+
+func TestBridgeCommandsZoneProfile(t *testing.T) {
+	b := Bridge{name: DefaultBridgeName, profile: testProfile(t, BulbRGBW, map[int]string{2: BulbCCT})}
+
+	l := models.Light{}
+	l.SetZone(2)
+	l.SetColor("#ffffff")
+
+	cmds, err := b.commands(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].(fmt.Stringer).String() != "zone 2 brightness 64" {
+		t.Errorf("expected white light translated into brightness, got %v", cmds)
+	}
+
+	l.Clear()
+	l.SetZone(2)
+	l.SetHue(10)
+
+	_, err = b.commands(l)
+	if !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedFeature, err)
+	}
+
+	l.Clear()
+	l.SetKelvin(3000)
+
+	_, err = b.commands(l)
+	if err != nil {
+		t.Errorf("expected kelvin supported by some zone, got %v", err)
+	}
+
+	l.Clear()
+	l.SetSaturation(10)
+
+	_, err = b.commands(l)
+	if !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedFeature, err)
+	}
+}
+
+func TestBridgeLinkInvalid(t *testing.T) {
+	cases := []struct {
+		bulb     string
+		zone     int
+		duration int
+		err      error
+	}{
+		{BulbRGBW, models.ZoneAll, 0, ErrInvalidZone},
+		{BulbRGBW, models.MaxZone + 1, 0, ErrInvalidZone},
+		{BulbRGBW, 1, -1, ErrInvalidValue},
+		{BulbRGBW, 1, int(maxLinkWindow/time.Millisecond) + 1, ErrInvalidValue},
+		{BulbBridgeLamp, 1, 0, ErrUnsupportedFeature},
+	}
+	for _, tc := range cases {
+		b := Bridge{name: DefaultBridgeName, profile: testProfile(t, tc.bulb, nil), linkWindow: time.Second}
+		err := b.Link(tc.zone, tc.duration, false)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s zone %d duration %d: expected %v, got %v", tc.bulb, tc.zone, tc.duration, tc.err, err)
+		}
+	}
+}
+
+func TestBridgeCommandsLegacyProtocol(t *testing.T) {
+	p, err := NewProfile(ProtocolLegacy, "", map[int]string{2: BulbCCT})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := Bridge{name: DefaultBridgeName, profile: p}
+
+	if p.Bulb(1) != BulbRGBW {
+		t.Errorf("expected default bulb %s, got %s", BulbRGBW, p.Bulb(1))
+	}
+
+	l := models.Light{}
+	l.SetZone(1)
+	l.SetMode(2)
+
+	_, err = b.commands(l)
+	if !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedFeature, err)
+	}
+
+	l.Clear()
+	l.SetZone(2)
+	l.SetKelvin(3000)
+
+	_, err = b.commands(l)
+	if err != nil {
+		t.Errorf("expected kelvin supported, got %v", err)
+	}
+}
+
+func TestBridgeDevices(t *testing.T) {
+	b := Bridge{name: DefaultBridgeName, profile: testProfile(t, BulbRGBW, map[int]string{3: BulbRGBWW})}
+
+	devices := b.Devices()
+
+	if len(devices) != models.MaxZone {
+		t.Fatalf("expected %d devices, got %d", models.MaxZone, len(devices))
+	}
+
+	for i, d := range devices {
+		if d.Bridge != DefaultBridgeName || d.Zone != i+1 {
+			t.Errorf("unexpected device %v", d)
+		}
+	}
+
+	if devices[2].Bulb != BulbRGBWW || !devices[2].Capabilities.Kelvin {
+		t.Errorf("expected %s with kelvin, got %v", BulbRGBWW, devices[2])
+	}
+
+	if devices[0].Bulb != BulbRGBW || devices[0].Capabilities.Kelvin {
+		t.Errorf("expected %s without kelvin, got %v", BulbRGBW, devices[0])
+	}
+}
+
+func testProfile(t *testing.T, bulb string, zones map[int]string) *Profile {
+	p, err := NewProfile(ProtocolV6, bulb, zones)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,58 @@
+package milightd
+
+import (
+	"errors"
+
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+// Supported bulb types.
+const (
+	// BulbBridgeLamp is the lamp built into the iBox bridge.
+	BulbBridgeLamp = "ibox"
+	// BulbCCT is the dual white bulb.
+	BulbCCT = "cct"
+	// BulbRGBW is the color bulb with white LEDs.
+	BulbRGBW = "rgbw"
+	// BulbRGBWW is the color bulb with dual white LEDs (RGB+CCT).
+	BulbRGBWW = "rgbww"
+)
+
+var (
+	// ErrUnsupportedFeature is returned when light control command uses feature not supported by the bulb.
+	ErrUnsupportedFeature = errors.New("feature not supported by bulb")
+)
+
+// legacyCapabilities maps bulb types supported by legacy bridge into features available through legacy protocol.
+// Legacy bridge can only cycle through effect modes, so they are not supported.
+var legacyCapabilities = map[string]models.Capabilities{
+	BulbCCT:  {Switch: true, Brightness: true, Kelvin: true, Night: true, Link: true},
+	BulbRGBW: {Switch: true, Brightness: true, Color: true, White: true, Night: true, Link: true},
+}
+
+// bulbType describes bulb type.
+type bulbType struct {
+	device       ibox.DeviceType
+	capabilities models.Capabilities
+}
+
+// bulbTypes maps bulb type name into its description.
+var bulbTypes = map[string]bulbType{
+	BulbBridgeLamp: {
+		device:       ibox.BridgeLamp,
+		capabilities: models.Capabilities{Switch: true, Brightness: true, Color: true, White: true, Modes: true},
+	},
+	BulbCCT: {
+		device:       ibox.CCT,
+		capabilities: models.Capabilities{Switch: true, Brightness: true, Kelvin: true, Night: true, Link: true},
+	},
+	BulbRGBW: {
+		device:       ibox.RGBW,
+		capabilities: models.Capabilities{Switch: true, Brightness: true, Color: true, White: true, Modes: true, Night: true, Link: true},
+	},
+	BulbRGBWW: {
+		device:       ibox.RGBWW,
+		capabilities: models.Capabilities{Switch: true, Brightness: true, Color: true, White: true, Saturation: true, Kelvin: true, Modes: true, Night: true, Link: true},
+	},
+}
@@ -0,0 +1,182 @@
+package milightd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+const (
+	// whiteSaturationThreshold is the saturation below which color is rendered as white light.
+	whiteSaturationThreshold = 0.15
+)
+
+var (
+	// ErrInvalidColor is returned when light control command contains unsupported color.
+	ErrInvalidColor = errors.New("invalid color")
+)
+
+// colorSetting represents Mi-Light color setting resolved from color specification.
+type colorSetting struct {
+	white bool
+	hue   byte
+	// brightness derived from color specification, nil for named colors.
+	brightness *int
+}
+
+// parseColor converts color name, #rrggbb, rgb() or hsl() specification into Mi-Light color setting.
+func parseColor(spec string) (*colorSetting, error) {
+	s := strings.ToLower(strings.TrimSpace(spec))
+
+	if s == white {
+		return &colorSetting{white: true}, nil
+	}
+
+	if hue, ok := colors[s]; ok {
+		return &colorSetting{hue: hue}, nil
+	}
+
+	var (
+		r, g, b float64
+		err     error
+	)
+
+	switch {
+	case strings.HasPrefix(s, "#"):
+		r, g, b, err = parseHexColor(s[1:])
+	case strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")"):
+		r, g, b, err = parseRGBColor(s[4 : len(s)-1])
+	case strings.HasPrefix(s, "hsl(") && strings.HasSuffix(s, ")"):
+		r, g, b, err = parseHSLColor(s[4 : len(s)-1])
+	default:
+		err = ErrInvalidColor
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidColor, spec)
+	}
+
+	return rgbToColorSetting(r, g, b), nil
+}
+
+// hueToByte converts hue in degrees into Mi-Light hue value, scaled the same way as milight color constants.
+func hueToByte(h float64) byte {
+	return byte(h * models.MaxHue / 360)
+}
+
+// rgbToColorSetting converts RGB components in range 0-1 into the closest Mi-Light color setting.
+func rgbToColorSetting(r, g, b float64) *colorSetting {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+
+	brightness := int(math.Round(max * models.MaxBrightness))
+
+	var saturation float64
+	if max > 0 {
+		saturation = (max - min) / max
+	}
+
+	if saturation < whiteSaturationThreshold {
+		return &colorSetting{white: true, brightness: &brightness}
+	}
+
+	var h float64
+	d := max - min
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+
+	return &colorSetting{hue: hueToByte(h), brightness: &brightness}
+}
+
+// parseHexColor parses rrggbb or rgb hex notation.
+func parseHexColor(s string) (float64, float64, float64, error) {
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return 0, 0, 0, ErrInvalidColor
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return float64(v>>16&0xFF) / 255, float64(v>>8&0xFF) / 255, float64(v&0xFF) / 255, nil
+}
+
+// parseRGBColor parses r, g, b components in range 0-255.
+func parseRGBColor(s string) (float64, float64, float64, error) {
+	c, err := parseComponents(s)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, v := range c {
+		if v < 0 || v > 255 {
+			return 0, 0, 0, ErrInvalidColor
+		}
+	}
+	return c[0] / 255, c[1] / 255, c[2] / 255, nil
+}
+
+// parseHSLColor parses hue in degrees, saturation and lightness in percents.
+func parseHSLColor(s string) (float64, float64, float64, error) {
+	c, err := parseComponents(s)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	h, sat, l := math.Mod(c[0], 360), c[1]/100, c[2]/100
+	if h < 0 {
+		h += 360
+	}
+	if sat < 0 || sat > 1 || l < 0 || l > 1 {
+		return 0, 0, 0, ErrInvalidColor
+	}
+	chroma := (1 - math.Abs(2*l-1)) * sat
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - chroma/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = chroma, x, 0
+	case h < 120:
+		r, g, b = x, chroma, 0
+	case h < 180:
+		r, g, b = 0, chroma, x
+	case h < 240:
+		r, g, b = 0, x, chroma
+	case h < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	return r + m, g + m, b + m, nil
+}
+
+// parseComponents parses three comma separated numbers, optionally followed by percent sign.
+func parseComponents(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return nil, ErrInvalidColor
+	}
+	c := make([]float64, 0, 3)
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(p), "%"), 64)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, v)
+	}
+	return c, nil
+}
@@ -0,0 +1,107 @@
+package milightd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestParseColor(t *testing.T) {
+	cases := []struct {
+		spec       string
+		white      bool
+		hue        byte
+		brightness int
+	}{
+		{"#ff0000", false, milight.Red, 64},
+		{"#FFFF00", false, milight.Yellow, 64},
+		{"#0f0", false, milight.Green, 64},
+		{"#000080", false, milight.Blue, 32},
+		{"rgb(0, 255, 255)", false, milight.Cyan, 64},
+		{"rgb(255,0,255)", false, milight.Magenta, 64},
+		{"hsl(240, 100%, 50%)", false, milight.Blue, 64},
+		{"hsl(120, 100%, 25%)", false, milight.Green, 32},
+		{"#808080", true, 0, 32},
+		{"rgb(250, 245, 240)", true, 0, 63},
+		{"hsl(0, 5%, 100%)", true, 0, 64},
+	}
+	for _, tc := range cases {
+		setting, err := parseColor(tc.spec)
+		if err != nil {
+			t.Errorf("%s: %s", tc.spec, err)
+			continue
+		}
+		if setting.white != tc.white {
+			t.Errorf("%s: expected white %v, got %v", tc.spec, tc.white, setting.white)
+		}
+		if !tc.white && setting.hue != tc.hue {
+			t.Errorf("%s: expected hue 0x%X, got 0x%X", tc.spec, tc.hue, setting.hue)
+		}
+		if setting.brightness == nil {
+			t.Errorf("%s: expected brightness %d, got nil", tc.spec, tc.brightness)
+		} else if *setting.brightness != tc.brightness {
+			t.Errorf("%s: expected brightness %d, got %d", tc.spec, tc.brightness, *setting.brightness)
+		}
+	}
+}
+
+func TestParseColorName(t *testing.T) {
+	setting, err := parseColor("Violet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setting.hue != milight.Violet {
+		t.Errorf("expected hue 0x%X, got 0x%X", milight.Violet, setting.hue)
+	}
+	if setting.brightness != nil {
+		t.Errorf("expected nil brightness, got %d", *setting.brightness)
+	}
+
+	setting, err = parseColor(white)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !setting.white {
+		t.Error("expected white")
+	}
+}
+
+func TestParseColorInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"pink",
+		"#12345",
+		"#gg0000",
+		"rgb(256, 0, 0)",
+		"rgb(1, 2)",
+		"hsl(10, 120%, 50%)",
+		"hsl(a, b, c)",
+	}
+	for _, tc := range cases {
+		_, err := parseColor(tc)
+		if !errors.Is(err, ErrInvalidColor) {
+			t.Errorf("%s: expected %v, got %v", tc, ErrInvalidColor, err)
+		}
+	}
+}
+
+func TestBridgeProcessInvalidColor(t *testing.T) {
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: "127.0.0.1", Port: DefaultBridgePort}, testProfile(t, BulbRGBW, nil))
+	defer b.Close()
+
+	cases := []models.Light{{}, {}, {}}
+	cases[0].SetColor("pink")
+	cases[1].SetHue(models.MaxHue + 1)
+	cases[2].SetColor("red")
+	cases[2].SetHue(1)
+
+	for _, tc := range cases {
+		err := b.Process(context.Background(), PriorityInteractive, tc)
+		if !errors.Is(err, ErrInvalidColor) {
+			t.Errorf("%s: expected %v, got %v", tc.String(), ErrInvalidColor, err)
+		}
+	}
+}
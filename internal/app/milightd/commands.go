@@ -2,6 +2,7 @@ package milightd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/sgrzywna/milight"
 	"github.com/sgrzywna/milightd/pkg/models"
@@ -21,9 +22,19 @@ const (
 	violet          = "violet"
 	magenta         = "magenta"
 	rose            = "rose"
+
+	// minKelvin is the warmest white light temperature supported by the bulbs.
+	minKelvin = 2700
+	// maxKelvin is the coolest white light temperature supported by the bulbs.
+	maxKelvin = 6500
+	// maxLevel is the maximal temperature and saturation level accepted by the bulbs.
+	maxLevel = 0x64
+
+	// linkInterval is the delay between repeated link commands.
+	linkInterval = 500 * time.Millisecond
 )
 
-// colors maps color name with corresponding color value.
+// colors maps color name with corresponding Mi-Light hue value.
 var colors = map[string]byte{
 	red:             milight.Red,
 	orange:          milight.Orange,
@@ -39,42 +50,194 @@ var colors = map[string]byte{
 	rose:            milight.Rose,
 }
 
-// LightSwitch represents command to switch on/off the light.
+// LightSwitch represents command to switch on/off the light or to turn night light on.
 type LightSwitch struct {
-	on string
+	zone byte
+	on   string
 }
 
 // Exec executes command.
 func (c *LightSwitch) Exec(lc LightController) error {
-	if c.on == models.On {
-		return lc.On()
+	switch c.on {
+	case models.On:
+		return lc.On(c.zone)
+	case models.Night:
+		return lc.Night(c.zone)
+	default:
+		return lc.Off(c.zone)
 	}
-	return lc.Off()
+}
+
+// String implements string representation of the command.
+func (c *LightSwitch) String() string {
+	return fmt.Sprintf("zone %d light switch %s", c.zone, c.on)
 }
 
 // LightBrightness represents command to control light brightness.
 type LightBrightness struct {
+	zone  byte
 	level int
 }
 
 // Exec executes command.
 func (c *LightBrightness) Exec(lc LightController) error {
-	return lc.Brightness(byte(c.level))
+	return lc.Brightness(c.zone, byte(c.level))
 }
 
-// LightColor represents command to control light color.
+// String implements string representation of the command.
+func (c *LightBrightness) String() string {
+	return fmt.Sprintf("zone %d brightness %d", c.zone, c.level)
+}
+
+// LightColor represents command to control light color given by name, #rrggbb, rgb() or hsl() specification.
 type LightColor struct {
+	zone  byte
 	color string
 }
 
 // Exec executes command.
 func (c *LightColor) Exec(lc LightController) error {
-	if c.color == white {
-		return lc.White()
+	setting, err := parseColor(c.color)
+	if err != nil {
+		return err
+	}
+	if setting.white {
+		return lc.White(c.zone)
+	}
+	return lc.Color(c.zone, setting.hue)
+}
+
+// String implements string representation of the command.
+func (c *LightColor) String() string {
+	return fmt.Sprintf("zone %d color %s", c.zone, c.color)
+}
+
+// LightHue represents command to control light color given by Mi-Light hue value.
+type LightHue struct {
+	zone byte
+	hue  byte
+}
+
+// Exec executes command.
+func (c *LightHue) Exec(lc LightController) error {
+	return lc.Color(c.zone, c.hue)
+}
+
+// String implements string representation of the command.
+func (c *LightHue) String() string {
+	return fmt.Sprintf("zone %d hue %d", c.zone, c.hue)
+}
+
+// LightSaturation represents command to control color saturation.
+type LightSaturation struct {
+	zone  byte
+	level int
+}
+
+// Exec executes command.
+func (c *LightSaturation) Exec(lc LightController) error {
+	return lc.Saturation(c.zone, byte(c.level))
+}
+
+// String implements string representation of the command.
+func (c *LightSaturation) String() string {
+	return fmt.Sprintf("zone %d saturation %d", c.zone, c.level)
+}
+
+// LightTemperature represents command to control white light temperature.
+type LightTemperature struct {
+	zone   byte
+	kelvin int
+}
+
+// Exec executes command.
+func (c *LightTemperature) Exec(lc LightController) error {
+	return lc.Temperature(c.zone, kelvinToTemperature(c.kelvin))
+}
+
+// String implements string representation of the command.
+func (c *LightTemperature) String() string {
+	return fmt.Sprintf("zone %d kelvin %d", c.zone, c.kelvin)
+}
+
+// LightMode represents command to start built-in effect mode.
+type LightMode struct {
+	zone byte
+	mode int
+}
+
+// Exec executes command.
+func (c *LightMode) Exec(lc LightController) error {
+	return lc.Mode(c.zone, byte(c.mode))
+}
+
+// String implements string representation of the command.
+func (c *LightMode) String() string {
+	return fmt.Sprintf("zone %d mode %d", c.zone, c.mode)
+}
+
+// LightSpeed represents command to change effect mode speed.
+type LightSpeed struct {
+	zone  byte
+	speed string
+}
+
+// Exec executes command.
+func (c *LightSpeed) Exec(lc LightController) error {
+	if c.speed == models.SpeedUp {
+		return lc.SpeedUp(c.zone)
+	}
+	return lc.SpeedDown(c.zone)
+}
+
+// String implements string representation of the command.
+func (c *LightSpeed) String() string {
+	return fmt.Sprintf("zone %d speed %s", c.zone, c.speed)
+}
+
+// ZoneLink represents command to pair or unpair bulbs with the zone.
+// Link sequence is repeated for the whole pairing window, so the bulb can be powered on at any time within it.
+type ZoneLink struct {
+	zone   byte
+	unlink bool
+	window time.Duration
+}
+
+// Exec executes command.
+func (c *ZoneLink) Exec(lc LightController) error {
+	deadline := time.Now().Add(c.window)
+	for {
+		var err error
+		if c.unlink {
+			err = lc.Unlink(c.zone)
+		} else {
+			err = lc.Link(c.zone)
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().Add(linkInterval).After(deadline) {
+			return nil
+		}
+		time.Sleep(linkInterval)
+	}
+}
+
+// String implements string representation of the command.
+func (c *ZoneLink) String() string {
+	if c.unlink {
+		return fmt.Sprintf("zone %d unlink %s", c.zone, c.window)
+	}
+	return fmt.Sprintf("zone %d link %s", c.zone, c.window)
+}
+
+// kelvinToTemperature maps white light temperature onto the bulb warm-cool range.
+func kelvinToTemperature(kelvin int) byte {
+	if kelvin <= minKelvin {
+		return 0
 	}
-	color, ok := colors[c.color]
-	if !ok {
-		return fmt.Errorf("unsupported color")
+	if kelvin >= maxKelvin {
+		return maxLevel
 	}
-	return lc.Color(color)
+	return byte((kelvin - minKelvin) * maxLevel / (maxKelvin - minKelvin))
 }
@@ -8,40 +8,101 @@ import (
 )
 
 type TestLightController struct {
-	on         bool
-	off        bool
-	color      byte
-	white      bool
-	brightness byte
+	zone        byte
+	on          bool
+	off         bool
+	night       bool
+	color       byte
+	white       bool
+	brightness  byte
+	saturation  byte
+	temperature byte
+	mode        byte
+	speed       int
+	link        int
+	unlink      int
 }
 
-func (lc *TestLightController) On() error {
+func (lc *TestLightController) On(zone byte) error {
+	lc.zone = zone
 	lc.on = true
 	return nil
 }
 
-func (lc *TestLightController) Off() error {
+func (lc *TestLightController) Off(zone byte) error {
+	lc.zone = zone
 	lc.off = true
 	return nil
 }
 
-func (lc *TestLightController) Color(color byte) error {
+func (lc *TestLightController) Night(zone byte) error {
+	lc.zone = zone
+	lc.night = true
+	return nil
+}
+
+func (lc *TestLightController) Color(zone byte, color byte) error {
+	lc.zone = zone
 	lc.color = color
 	return nil
 }
 
-func (lc *TestLightController) White() error {
+func (lc *TestLightController) White(zone byte) error {
+	lc.zone = zone
 	lc.white = true
 	return nil
 }
 
-func (lc *TestLightController) Brightness(brightness byte) error {
+func (lc *TestLightController) Brightness(zone byte, brightness byte) error {
+	lc.zone = zone
 	lc.brightness = brightness
 	return nil
 }
 
+func (lc *TestLightController) Saturation(zone byte, saturation byte) error {
+	lc.zone = zone
+	lc.saturation = saturation
+	return nil
+}
+
+func (lc *TestLightController) Temperature(zone byte, temperature byte) error {
+	lc.zone = zone
+	lc.temperature = temperature
+	return nil
+}
+
+func (lc *TestLightController) Mode(zone byte, mode byte) error {
+	lc.zone = zone
+	lc.mode = mode
+	return nil
+}
+
+func (lc *TestLightController) SpeedUp(zone byte) error {
+	lc.zone = zone
+	lc.speed++
+	return nil
+}
+
+func (lc *TestLightController) SpeedDown(zone byte) error {
+	lc.zone = zone
+	lc.speed--
+	return nil
+}
+
+func (lc *TestLightController) Link(zone byte) error {
+	lc.zone = zone
+	lc.link++
+	return nil
+}
+
+func (lc *TestLightController) Unlink(zone byte) error {
+	lc.zone = zone
+	lc.unlink++
+	return nil
+}
+
 func TestLightSwitchOn(t *testing.T) {
-	c := LightSwitch{models.On}
+	c := LightSwitch{on: models.On}
 	lc := TestLightController{}
 	err := c.Exec(&lc)
 	if err != nil {
@@ -56,7 +117,7 @@ func TestLightSwitchOn(t *testing.T) {
 }
 
 func TestLightSwitchOff(t *testing.T) {
-	c := LightSwitch{models.Off}
+	c := LightSwitch{on: models.Off}
 	lc := TestLightController{}
 	err := c.Exec(&lc)
 	if err != nil {
@@ -70,8 +131,23 @@ func TestLightSwitchOff(t *testing.T) {
 	}
 }
 
+func TestLightSwitchNight(t *testing.T) {
+	c := LightSwitch{on: models.Night}
+	lc := TestLightController{}
+	err := c.Exec(&lc)
+	if err != nil {
+		t.Error(err)
+	}
+	if !lc.night {
+		t.Error("LightSwitchNight failed")
+	}
+	if lc.on || lc.off {
+		t.Error("Expected LightSwitchNight, got LightSwitchOn or LightSwitchOff")
+	}
+}
+
 func TestLightSwitchInvalid(t *testing.T) {
-	c := LightSwitch{"noronoroff"}
+	c := LightSwitch{on: "noronoroff"}
 	lc := TestLightController{}
 	err := c.Exec(&lc)
 	if err != nil {
@@ -87,7 +163,7 @@ func TestLightSwitchInvalid(t *testing.T) {
 
 func TestLightBrightness(t *testing.T) {
 	b := 12
-	c := LightBrightness{b}
+	c := LightBrightness{level: b}
 	lc := TestLightController{}
 	err := c.Exec(&lc)
 	if err != nil {
@@ -99,7 +175,7 @@ func TestLightBrightness(t *testing.T) {
 }
 
 func TestLightColor(t *testing.T) {
-	c := LightColor{yellow}
+	c := LightColor{color: yellow}
 	lc := TestLightController{}
 	err := c.Exec(&lc)
 	if err != nil {
@@ -111,7 +187,7 @@ func TestLightColor(t *testing.T) {
 }
 
 func TestLightColorWhite(t *testing.T) {
-	c := LightColor{white}
+	c := LightColor{color: white}
 	lc := TestLightController{}
 	err := c.Exec(&lc)
 	if err != nil {
@@ -122,11 +198,147 @@ func TestLightColorWhite(t *testing.T) {
 	}
 }
 
+func TestLightColorRGB(t *testing.T) {
+	c := LightColor{color: "#0000ff"}
+	lc := TestLightController{}
+	err := c.Exec(&lc)
+	if err != nil {
+		t.Error(err)
+	}
+	if lc.color != milight.Blue {
+		t.Errorf("LightColor expected: %d, got: %d", milight.Blue, lc.color)
+	}
+}
+
+func TestLightHue(t *testing.T) {
+	var hue byte = 0x30
+	c := LightHue{hue: hue}
+	lc := TestLightController{}
+	err := c.Exec(&lc)
+	if err != nil {
+		t.Error(err)
+	}
+	if lc.color != hue {
+		t.Errorf("LightHue expected: %d, got: %d", hue, lc.color)
+	}
+}
+
+func TestLightSaturation(t *testing.T) {
+	s := 40
+	c := LightSaturation{level: s}
+	lc := TestLightController{}
+	err := c.Exec(&lc)
+	if err != nil {
+		t.Error(err)
+	}
+	if int(lc.saturation) != s {
+		t.Errorf("LightSaturation expected: %d, got: %d", s, lc.saturation)
+	}
+}
+
+func TestLightTemperature(t *testing.T) {
+	cases := []struct {
+		kelvin      int
+		temperature byte
+	}{
+		{2000, 0},
+		{minKelvin, 0},
+		{4600, 50},
+		{maxKelvin, maxLevel},
+		{10000, maxLevel},
+	}
+	for _, tc := range cases {
+		c := LightTemperature{kelvin: tc.kelvin}
+		lc := TestLightController{}
+		err := c.Exec(&lc)
+		if err != nil {
+			t.Error(err)
+		}
+		if lc.temperature != tc.temperature {
+			t.Errorf("LightTemperature %dK expected: %d, got: %d", tc.kelvin, tc.temperature, lc.temperature)
+		}
+	}
+}
+
+func TestLightMode(t *testing.T) {
+	m := 4
+	c := LightMode{mode: m}
+	lc := TestLightController{}
+	err := c.Exec(&lc)
+	if err != nil {
+		t.Error(err)
+	}
+	if int(lc.mode) != m {
+		t.Errorf("LightMode expected: %d, got: %d", m, lc.mode)
+	}
+}
+
+func TestLightSpeed(t *testing.T) {
+	lc := TestLightController{}
+	for _, c := range []LightSpeed{{speed: models.SpeedUp}, {speed: models.SpeedUp}, {speed: models.SpeedDown}} {
+		err := c.Exec(&lc)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if lc.speed != 1 {
+		t.Errorf("LightSpeed expected: %d, got: %d", 1, lc.speed)
+	}
+}
+
+func TestZoneLink(t *testing.T) {
+	lc := TestLightController{}
+	c := ZoneLink{zone: 2, window: 3 * linkInterval}
+	err := c.Exec(&lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc.link != 3 || lc.unlink != 0 {
+		t.Errorf("ZoneLink expected: %d links, got: %d links and %d unlinks", 3, lc.link, lc.unlink)
+	}
+
+	lc = TestLightController{}
+	c = ZoneLink{zone: 2, unlink: true}
+	err = c.Exec(&lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc.link != 0 || lc.unlink != 1 {
+		t.Errorf("ZoneLink expected: %d unlinks, got: %d links and %d unlinks", 1, lc.link, lc.unlink)
+	}
+}
+
 func TestLightInvalid(t *testing.T) {
-	c := LightColor{"notexisting"}
+	c := LightColor{color: "notexisting"}
 	lc := TestLightController{}
 	err := c.Exec(&lc)
 	if err == nil {
 		t.Error("LightColor expected error, got nil")
 	}
 }
+
+func TestLightZone(t *testing.T) {
+	var zone byte = 3
+	cases := []Command{
+		&LightSwitch{zone: zone, on: models.On},
+		&LightBrightness{zone: zone, level: 12},
+		&LightColor{zone: zone, color: yellow},
+		&LightColor{zone: zone, color: white},
+		&LightHue{zone: zone, hue: 0x10},
+		&LightSaturation{zone: zone, level: 10},
+		&LightTemperature{zone: zone, kelvin: 3000},
+		&LightMode{zone: zone, mode: 2},
+		&LightSpeed{zone: zone, speed: models.SpeedDown},
+		&ZoneLink{zone: zone},
+	}
+	for _, c := range cases {
+		lc := TestLightController{}
+		err := c.Exec(&lc)
+		if err != nil {
+			t.Error(err)
+		}
+		if lc.zone != zone {
+			t.Errorf("%T expected zone: %d, got: %d", c, zone, lc.zone)
+		}
+	}
+}
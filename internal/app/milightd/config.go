@@ -0,0 +1,138 @@
+package milightd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// DefaultBridgeName is the name of the bridge configured with command line switches.
+	DefaultBridgeName = "default"
+	// DefaultBridgePort is the default Mi-Light iBox port.
+	DefaultBridgePort = 5987
+	// DefaultLegacyBridgePort is the default Mi-Light legacy WiFi bridge port.
+	DefaultLegacyBridgePort = 8899
+	// DefaultLinkWindow is the default duration of the pairing window in milliseconds.
+	DefaultLinkWindow = 5000
+	// DefaultQueueSize is the default number of commands waiting for execution.
+	DefaultQueueSize = 16
+	// DefaultQueueTimeout is the default time in milliseconds command waits for free place in the full queue.
+	DefaultQueueTimeout = 1000
+	// DefaultRetryAttempts is the default maximal number of command execution attempts.
+	DefaultRetryAttempts = 3
+	// DefaultRetryBackoff is the default delay in milliseconds before the first retry.
+	DefaultRetryBackoff = 500
+	// DefaultRetryMaxBackoff is the default longest delay in milliseconds between retries.
+	DefaultRetryMaxBackoff = 5000
+	// DefaultCommandDeadline is the default longest time in milliseconds since command was queued until its execution.
+	DefaultCommandDeadline = 10000
+	// DefaultBreakerThreshold is the default number of consecutive connection failures opening circuit breaker.
+	DefaultBreakerThreshold = 3
+	// DefaultBreakerCooldown is the default time in milliseconds open circuit breaker fails fast before probing the bridge.
+	DefaultBreakerCooldown = 10000
+	// DefaultReadyWindow is the default time in milliseconds bridge counts as reachable since the last successful connection.
+	DefaultReadyWindow = 60000
+	// DefaultFadeRate is the default number of intermediate commands per second sent during sequence step transition.
+	DefaultFadeRate = 10
+)
+
+// Supported bridge protocols.
+const (
+	// ProtocolV6 is the iBox bridge protocol.
+	ProtocolV6 = "v6"
+	// ProtocolLegacy is the v3/v4/v5 WiFi bridge protocol.
+	ProtocolLegacy = "legacy"
+)
+
+// Light state restore policies applied on startup.
+const (
+	// RestoreNone leaves the light untouched.
+	RestoreNone = "none"
+	// RestoreLast restores the last commanded light state.
+	RestoreLast = "last"
+	// RestoreDefault starts the named sequence.
+	RestoreDefault = "default"
+)
+
+// BridgeConfig represents Mi-Light bridge configuration.
+type BridgeConfig struct {
+	Name string `json:"name"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Protocol is the bridge protocol, iBox protocol when empty.
+	Protocol string `json:"protocol"`
+	// Bulb is the default type of bulbs paired with the bridge.
+	Bulb string `json:"bulb"`
+	// Zones overrides bulb type for the given zones.
+	Zones map[int]string `json:"zones"`
+	// LinkWindow is the default duration of the pairing window in milliseconds.
+	LinkWindow int `json:"linkWindow"`
+	// QueueSize is the number of commands waiting for execution, default size is used when 0.
+	QueueSize int `json:"queueSize"`
+	// QueueTimeout is the time in milliseconds command waits for free place in the full queue, default timeout is used when 0.
+	QueueTimeout int `json:"queueTimeout"`
+	// RetryAttempts is the maximal number of command execution attempts, default number is used when 0.
+	RetryAttempts int `json:"retryAttempts"`
+	// RetryBackoff is the delay in milliseconds before the first retry, doubled for every next one, default delay is used when 0.
+	RetryBackoff int `json:"retryBackoff"`
+	// RetryMaxBackoff is the longest delay in milliseconds between retries, default delay is used when 0.
+	RetryMaxBackoff int `json:"retryMaxBackoff"`
+	// CommandDeadline is the longest time in milliseconds since command was queued until its execution, default time is used when 0.
+	CommandDeadline int `json:"commandDeadline"`
+	// BreakerThreshold is the number of consecutive connection failures opening circuit breaker, default number is used when 0.
+	BreakerThreshold int `json:"breakerThreshold"`
+	// BreakerCooldown is the time in milliseconds open circuit breaker fails fast before probing the bridge, default time is used when 0.
+	BreakerCooldown int `json:"breakerCooldown"`
+	// ReadyWindow is the time in milliseconds bridge counts as reachable since the last successful connection, default time is used when 0.
+	// Idle bridge is probed twice within the window.
+	ReadyWindow int `json:"readyWindow"`
+	// FadeRate is the number of intermediate commands per second sent during sequence step transition, default rate is used when 0.
+	FadeRate int `json:"fadeRate"`
+	// ReconcileInterval is the period of re-sending the last light state in milliseconds, disabled when 0.
+	ReconcileInterval int `json:"reconcileInterval"`
+	// Restore is the light state restore policy applied on startup, nothing is done when empty.
+	Restore string `json:"restore"`
+	// RestoreDefault is the name of the sequence started on startup with the default restore policy.
+	RestoreDefault string `json:"restoreDefault"`
+}
+
+// Config represents milightd configuration.
+type Config struct {
+	Bridges []BridgeConfig `json:"bridges"`
+}
+
+// LoadConfig reads configuration from the JSON file.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cfg Config
+
+	err = json.NewDecoder(f).Decode(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse config %s: %s", path, err)
+	}
+
+	for i := range cfg.Bridges {
+		if cfg.Bridges[i].Port == 0 {
+			cfg.Bridges[i].Port = defaultPort(cfg.Bridges[i].Protocol)
+		}
+		if cfg.Bridges[i].LinkWindow == 0 {
+			cfg.Bridges[i].LinkWindow = DefaultLinkWindow
+		}
+	}
+
+	return &cfg, nil
+}
+
+// defaultPort returns the default port of the bridge speaking given protocol.
+func defaultPort(protocol string) int {
+	if protocol == ProtocolLegacy {
+		return DefaultLegacyBridgePort
+	}
+	return DefaultBridgePort
+}
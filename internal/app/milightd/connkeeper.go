@@ -2,7 +2,10 @@ package milightd
 
 import (
 	"log"
+	"sync"
 	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
 )
 
 const (
@@ -15,22 +18,31 @@ type ConnectionManagerer interface {
 	Allocate() (LightController, error)
 	Release()
 	GetStatus() (bool, bool)
+	LastResponse() (time.Time, bool)
+	Reset()
 	Terminate()
 }
 
 // ConnectionKeeper is responsible for managing network connection to the Mi-Light device.
+// Connection failures are recorded by the optional circuit breaker, which is probed by the keeper loop when open.
+// Idle bridge is probed every probe interval, so its reachability is known without light control commands.
 type ConnectionKeeper struct {
 	connman       ConnectionManagerer
 	connectionTTL time.Duration
+	probeInterval time.Duration
+	breaker       *CircuitBreaker
 	terminate     chan struct{}
+	mutex         sync.Mutex
 	lastActivity  time.Time
 }
 
-// NewConnectionKeeper returns initialized ConnectionManager object.
-func NewConnectionKeeper(connman ConnectionManagerer, connectionTTL time.Duration) *ConnectionKeeper {
+// NewConnectionKeeper returns initialized ConnectionManager object, breaker can be nil and zero probe interval disables idle bridge probing.
+func NewConnectionKeeper(connman ConnectionManagerer, connectionTTL time.Duration, probeInterval time.Duration, breaker *CircuitBreaker) *ConnectionKeeper {
 	keeper := ConnectionKeeper{
 		connman:       connman,
 		connectionTTL: connectionTTL,
+		probeInterval: probeInterval,
+		breaker:       breaker,
 		terminate:     make(chan struct{}),
 		lastActivity:  time.Now(),
 	}
@@ -44,18 +56,59 @@ func (k *ConnectionKeeper) Terminate() {
 	<-k.terminate
 }
 
-// Allocate allocates Mi-Light connection.
+// Reset closes broken Mi-Light connection, the next allocation creates a new one.
+func (k *ConnectionKeeper) Reset() {
+	if k.breaker != nil {
+		k.breaker.Failure()
+	}
+	k.connman.Reset()
+}
+
+// Allocate allocates Mi-Light connection, it fails fast when circuit breaker is open.
 func (k *ConnectionKeeper) Allocate() (LightController, error) {
-	k.lastActivity = time.Now()
-	return k.connman.Allocate()
+	k.activity()
+	if k.breaker == nil {
+		return k.connman.Allocate()
+	}
+	err := k.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	ml, err := k.connman.Allocate()
+	if err != nil {
+		k.breaker.Failure()
+		return nil, err
+	}
+	k.breaker.Success()
+	return ml, nil
+}
+
+// LastContact returns time of the last response from Mi-Light device, keep alive responses sustaining open connection included.
+// Zero time is returned when device was never reached, false when the bridge protocol doesn't respond to commands.
+func (k *ConnectionKeeper) LastContact() (time.Time, bool) {
+	return k.connman.LastResponse()
 }
 
 // Release releases Mi-Light connection.
 func (k *ConnectionKeeper) Release() {
-	k.lastActivity = time.Now()
+	k.activity()
 	k.connman.Release()
 }
 
+// activity records use of Mi-Light connection, it's called from the command loop and the keeper loop.
+func (k *ConnectionKeeper) activity() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.lastActivity = time.Now()
+}
+
+// idle returns time since the last use of Mi-Light connection.
+func (k *ConnectionKeeper) idle() time.Duration {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return time.Since(k.lastActivity)
+}
+
 // monitorLoop monitors Mi-Light connection.
 func (k *ConnectionKeeper) monitorLoop() {
 	log.Printf("milight monitoring loop started")
@@ -68,6 +121,7 @@ func (k *ConnectionKeeper) monitorLoop() {
 			return
 		case <-time.After(keeperCheckPeriod):
 			k.closeConnection()
+			k.probe()
 		}
 	}
 }
@@ -76,8 +130,40 @@ func (k *ConnectionKeeper) monitorLoop() {
 func (k *ConnectionKeeper) closeConnection() {
 	allocated, exists := k.connman.GetStatus()
 	if exists && !allocated {
-		if time.Since(k.lastActivity) > k.connectionTTL {
+		if k.idle() > k.connectionTTL {
 			k.connman.Terminate()
 		}
 	}
 }
+
+// probe tries connection when circuit breaker lets probe through or bridge wasn't reached within probe interval.
+// Open connection isn't probed, it's sustained with keep alive packets.
+func (k *ConnectionKeeper) probe() {
+	if k.breaker != nil {
+		if k.breaker.Available() != nil {
+			return
+		}
+		if k.breaker.Status().State != models.CircuitClosed {
+			k.tryConnection()
+			return
+		}
+	}
+	if k.probeInterval <= 0 {
+		return
+	}
+	if _, exists := k.connman.GetStatus(); exists {
+		return
+	}
+	if contact, ok := k.LastContact(); ok && time.Since(contact) > k.probeInterval {
+		k.tryConnection()
+	}
+}
+
+// tryConnection allocates and releases Mi-Light connection.
+func (k *ConnectionKeeper) tryConnection() {
+	_, err := k.Allocate()
+	if err != nil {
+		return
+	}
+	k.Release()
+}
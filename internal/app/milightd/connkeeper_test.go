@@ -1,6 +1,7 @@
 package milightd
 
 import (
+	"sync"
 	"testing"
 	"time"
 )
@@ -13,6 +14,8 @@ type TestConnectionManagerer struct {
 	terminateCalls   int
 	isAllocated      bool
 	isCreated        bool
+	lastResponse     time.Time
+	mux              sync.Mutex
 }
 
 func NewTestConnectionManagerer() *TestConnectionManagerer {
@@ -22,23 +25,42 @@ func NewTestConnectionManagerer() *TestConnectionManagerer {
 }
 
 func (m *TestConnectionManagerer) Allocate() (LightController, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
 	m.allocateCalls++
 	m.isAllocated = true
 	m.isCreated = true
+	m.lastResponse = time.Now()
 	return m.lightController, nil
 }
 
 func (m *TestConnectionManagerer) Release() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
 	m.releaseCalls++
 	m.isAllocated = false
 }
 
 func (m *TestConnectionManagerer) GetStatus() (bool, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
 	m.isAllocatedCalls++
 	return m.isAllocated, m.isCreated
 }
 
+func (m *TestConnectionManagerer) LastResponse() (time.Time, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.lastResponse, true
+}
+
+func (m *TestConnectionManagerer) Reset() {
+	m.Terminate()
+}
+
 func (m *TestConnectionManagerer) Terminate() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
 	m.terminateCalls++
 	m.isAllocated = false
 	m.isCreated = false
@@ -47,7 +69,7 @@ func (m *TestConnectionManagerer) Terminate() {
 func TestSingleAllocation(t *testing.T) {
 	checkPeriod := 3 * time.Second
 	connman := NewTestConnectionManagerer()
-	keeper := NewConnectionKeeper(connman, checkPeriod)
+	keeper := NewConnectionKeeper(connman, checkPeriod, 0, nil)
 	keeper.Allocate()
 	time.Sleep(1 * time.Second)
 	keeper.Release()
@@ -69,7 +91,7 @@ func TestSingleAllocation(t *testing.T) {
 func TestSingleAllocationLongerThanTTL(t *testing.T) {
 	checkPeriod := 2 * time.Second
 	connman := NewTestConnectionManagerer()
-	keeper := NewConnectionKeeper(connman, checkPeriod)
+	keeper := NewConnectionKeeper(connman, checkPeriod, 0, nil)
 	keeper.Allocate()
 	time.Sleep(2 * checkPeriod)
 	keeper.Release()
@@ -91,7 +113,7 @@ func TestSingleAllocationLongerThanTTL(t *testing.T) {
 func TestManyAllocations(t *testing.T) {
 	checkPeriod := 2 * time.Second
 	connman := NewTestConnectionManagerer()
-	keeper := NewConnectionKeeper(connman, checkPeriod)
+	keeper := NewConnectionKeeper(connman, checkPeriod, 0, nil)
 
 	for i := 0; i < 6; i++ {
 		keeper.Allocate()
@@ -117,7 +139,7 @@ func TestManyAllocations(t *testing.T) {
 func TestTerminations(t *testing.T) {
 	checkPeriod := 2 * time.Second
 	connman := NewTestConnectionManagerer()
-	keeper := NewConnectionKeeper(connman, checkPeriod)
+	keeper := NewConnectionKeeper(connman, checkPeriod, 0, nil)
 
 	keeper.Allocate()
 	time.Sleep(1 * time.Second)
@@ -139,3 +161,28 @@ func TestTerminations(t *testing.T) {
 		t.Errorf("expected %d releases, got %d", 1, connman.releaseCalls)
 	}
 }
+
+func TestIdleProbe(t *testing.T) {
+	connman := NewTestConnectionManagerer()
+	keeper := NewConnectionKeeper(connman, time.Minute, time.Second, nil)
+
+	if contact, _ := keeper.LastContact(); !contact.IsZero() {
+		t.Errorf("expected no contact, got %s", contact)
+	}
+
+	time.Sleep(keeperCheckPeriod + time.Second)
+
+	keeper.Terminate()
+
+	if connman.allocateCalls != 1 {
+		t.Errorf("expected %d allocations, got %d", 1, connman.allocateCalls)
+	}
+
+	if connman.releaseCalls != 1 {
+		t.Errorf("expected %d releases, got %d", 1, connman.releaseCalls)
+	}
+
+	if contact, _ := keeper.LastContact(); time.Since(contact) > keeperCheckPeriod {
+		t.Errorf("expected recent contact, got %s", contact)
+	}
+}
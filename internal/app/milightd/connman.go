@@ -3,24 +3,45 @@ package milightd
 import (
 	"log"
 	"sync"
+	"time"
 
-	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+	"github.com/sgrzywna/milightd/internal/pkg/legacy"
 )
 
+// bridgeConnection represents connection to Mi-Light bridge speaking one of supported protocols.
+type bridgeConnection interface {
+	LightController
+	Close() error
+}
+
+// responder represents bridge connection receiving responses to sent packets.
+type responder interface {
+	LastResponse() time.Time
+}
+
 // ConnectionManager repesents Mi-Light connection manager interface.
 type ConnectionManager struct {
-	addr      string
-	port      int
-	ml        *milight.Milight
-	allocated bool
-	mux       sync.Mutex
+	protocol    string
+	addr        string
+	port        int
+	zones       ibox.Zones
+	ml          bridgeConnection
+	allocated   bool
+	lost        bool
+	reconnected chan struct{}
+	response    time.Time
+	mux         sync.Mutex
 }
 
 // NewConnectionManager returns initialized ConnectionManager object.
-func NewConnectionManager(addr string, port int) *ConnectionManager {
+func NewConnectionManager(protocol string, addr string, port int, zones ibox.Zones) *ConnectionManager {
 	man := ConnectionManager{
-		addr: addr,
-		port: port,
+		protocol:    protocol,
+		addr:        addr,
+		port:        port,
+		zones:       zones,
+		reconnected: make(chan struct{}, 1),
 	}
 	return &man
 }
@@ -35,19 +56,63 @@ func (m *ConnectionManager) Allocate() (LightController, error) {
 		return m.ml, nil
 	}
 
-	ml, err := milight.NewMilight(m.addr, m.port)
+	var ml bridgeConnection
+	var err error
+
+	switch m.protocol {
+	case ProtocolLegacy:
+		ml, err = legacy.NewBridge(m.addr, m.port, m.zones)
+	default:
+		ml, err = ibox.NewBridge(m.addr, m.port, m.zones)
+	}
 	if err != nil {
+		m.lost = true
 		return nil, err
 	}
 
-	log.Printf("milight connected @ %s:%d", m.addr, m.port)
+	log.Printf("milight connected @ %s:%d (%s)", m.addr, m.port, m.protocolName())
 
 	m.ml = ml
 	m.allocated = true
 
+	if m.lost {
+		select {
+		case m.reconnected <- struct{}{}:
+		default:
+		}
+	}
+	m.lost = false
+
 	return m.ml, nil
 }
 
+// Reconnected returns channel notified when connection is re-established after failure or reset.
+// Connection closed by idle timeout is opened again without notification.
+func (m *ConnectionManager) Reconnected() <-chan struct{} {
+	return m.reconnected
+}
+
+// LastResponse returns time of the last response received from Mi-Light device, zero time when it never responded.
+// It returns false when the bridge protocol doesn't respond to commands, so its reachability can't be verified.
+func (m *ConnectionManager) LastResponse() (time.Time, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.protocol == ProtocolLegacy {
+		return time.Time{}, false
+	}
+	m.keepResponse()
+	return m.response, true
+}
+
+// keepResponse keeps time of the last response received through the current connection, so it outlives the connection.
+func (m *ConnectionManager) keepResponse() {
+	if r, ok := m.ml.(responder); ok {
+		if t := r.LastResponse(); t.After(m.response) {
+			m.response = t
+		}
+	}
+}
+
 // GetStatus returns status of the Mi-Light connection.
 func (m *ConnectionManager) GetStatus() (bool, bool) {
 	m.mux.Lock()
@@ -68,8 +133,31 @@ func (m *ConnectionManager) Terminate() {
 	defer m.mux.Unlock()
 	log.Printf("milight connection terminated")
 	if m.ml != nil {
+		m.keepResponse()
 		m.ml.Close()
 		m.ml = nil
 	}
 	m.allocated = false
 }
+
+// Reset closes broken Mi-Light connection, the next allocation notifies about re-established connection.
+func (m *ConnectionManager) Reset() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	log.Printf("milight connection reset")
+	if m.ml != nil {
+		m.keepResponse()
+		m.ml.Close()
+		m.ml = nil
+	}
+	m.allocated = false
+	m.lost = true
+}
+
+// protocolName returns name of the bridge protocol.
+func (m *ConnectionManager) protocolName() string {
+	if m.protocol == "" {
+		return ProtocolV6
+	}
+	return m.protocol
+}
@@ -0,0 +1,430 @@
+package milightd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+	"github.com/sgrzywna/milightd/internal/pkg/simulator"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestConnectionManagerSimulator(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, map[int]string{3: BulbCCT})
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	m := NewConnectionManager(ProtocolV6, host, port, profile.Devices())
+	defer m.Terminate()
+
+	lc, err := m.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Release()
+
+	err = lc.Color(2, milight.Green)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sim.Bulb(2).Hue != milight.Green {
+		t.Errorf("expected hue 0x%X, got 0x%X", milight.Green, sim.Bulb(2).Hue)
+	}
+}
+
+func TestConnectionManagerReconnected(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	m := NewConnectionManager(ProtocolV6, host, port, profile.Devices())
+	defer m.Terminate()
+
+	// connection closed by idle timeout is opened again without notification, reset one is notified
+	for i, reset := range []bool{false, true, false} {
+		_, err := m.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Release()
+
+		select {
+		case <-m.Reconnected():
+			if i < 2 {
+				t.Errorf("connection %d: unexpected reconnection notification", i)
+			}
+		default:
+			if i == 2 {
+				t.Errorf("connection %d: expected reconnection notification", i)
+			}
+		}
+
+		if reset {
+			m.Reset()
+		} else {
+			m.Terminate()
+		}
+	}
+}
+
+func TestBridgeSimulator(t *testing.T) {
+	profile := testProfile(t, BulbRGBWW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port}, profile)
+	defer b.Close()
+
+	l := models.Light{}
+	l.SetZone(4)
+	l.SetSwitch(true)
+	l.SetColor("blue")
+	l.SetBrightness(32)
+
+	err := b.Process(context.Background(), PriorityInteractive, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := simulator.Bulb{Device: profile.Devices()[4], Linked: true, On: true, Hue: milight.Blue, Brightness: 32}
+
+	deadline := time.Now().Add(time.Second)
+	for sim.Bulb(4) != expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if sim.Bulb(4) != expected {
+		t.Errorf("expected %+v, got %+v", expected, sim.Bulb(4))
+	}
+}
+
+func TestBridgeCoalesce(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port}, profile)
+	defer b.Close()
+
+	for level := 1; level <= 30; level++ {
+		l := models.Light{}
+		l.SetZone(3)
+		l.SetBrightness(level)
+		err := b.Process(context.Background(), PriorityInteractive, l)
+		if err != nil {
+			t.Fatalf("brightness %d: %s", level, err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for sim.Bulb(3).Brightness != 30 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if sim.Bulb(3).Brightness != 30 {
+		t.Errorf("expected brightness %d, got %d", 30, sim.Bulb(3).Brightness)
+	}
+}
+
+func TestBridgeProcessSync(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port}, profile)
+	defer b.Close()
+
+	l := models.Light{}
+	l.SetZone(1)
+	l.SetSwitch(true)
+
+	err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sim.Bulb(1).On {
+		t.Errorf("expected bulb on, got %+v", sim.Bulb(1))
+	}
+
+	state := b.State()[0]
+	if state.Switch == nil || *state.Switch != models.On || !state.LastSend.Success {
+		t.Errorf("expected tracked switch %s, got %v", models.On, state.Switch)
+	}
+
+	sim.Close()
+
+	offline := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port}, profile)
+	defer offline.Close()
+
+	err = offline.ProcessSync(context.Background(), PriorityInteractive, l)
+	if !errors.Is(err, ErrBridgeUnavailable) && !errors.Is(err, ErrBridgeTimeout) {
+		t.Errorf("expected %v or %v, got %v", ErrBridgeUnavailable, ErrBridgeTimeout, err)
+	}
+}
+
+func TestBridgeReady(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port}, profile)
+	defer b.Close()
+
+	checks := b.Ready()
+	if checks[0].Name != models.CheckBridge || checks[0].Status != models.HealthFailed {
+		t.Errorf("expected failed %s check, got %+v", models.CheckBridge, checks[0])
+	}
+	if checks[1].Name != models.CheckLoop || checks[1].Status != models.HealthOK {
+		t.Errorf("expected passed %s check, got %+v", models.CheckLoop, checks[1])
+	}
+
+	l := models.Light{}
+	l.SetZone(1)
+	l.SetSwitch(true)
+
+	err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks = b.Ready()
+	if checks[0].Status != models.HealthOK {
+		t.Errorf("expected passed %s check, got %+v", models.CheckBridge, checks[0])
+	}
+
+	b.setBusy(time.Now().Add(-b.retry.deadline - maxLinkWindow - time.Second))
+	checks = b.Ready()
+	b.setBusy(time.Time{})
+	if checks[1].Status != models.HealthFailed {
+		t.Errorf("expected failed %s check, got %+v", models.CheckLoop, checks[1])
+	}
+}
+
+func TestBridgeReadyUnresponsive(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port, ReadyWindow: 200}, profile)
+	defer b.Close()
+
+	l := models.Light{}
+	l.SetZone(1)
+	l.SetSwitch(true)
+
+	err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checks := b.Ready(); checks[0].Status != models.HealthOK {
+		t.Errorf("expected passed %s check, got %+v", models.CheckBridge, checks[0])
+	}
+
+	// connection stays open until idle timeout, but the bridge doesn't respond anymore
+	sim.Close()
+	time.Sleep(300 * time.Millisecond)
+
+	if checks := b.Ready(); checks[0].Status != models.HealthFailed {
+		t.Errorf("expected failed %s check, got %+v", models.CheckBridge, checks[0])
+	}
+}
+
+func TestBridgeReadyLegacy(t *testing.T) {
+	profile, err := NewProfile(ProtocolLegacy, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: "127.0.0.1", Port: 8899, Protocol: ProtocolLegacy}, profile)
+	defer b.Close()
+
+	checks := b.Ready()
+	if checks[0].Status != models.HealthOK || !strings.Contains(checks[0].Detail, "can't be verified") {
+		t.Errorf("expected passed %s check with unverified reachability, got %+v", models.CheckBridge, checks[0])
+	}
+}
+
+func TestBridgeCloseDrainsQueue(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port}, profile)
+
+	for zone := 1; zone <= models.MaxZone; zone++ {
+		l := models.Light{}
+		l.SetZone(zone)
+		l.SetSwitch(true)
+		l.SetBrightness(32)
+		err := b.Process(context.Background(), PriorityInteractive, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b.Close()
+
+	// pending commands are executed before the connection is closed for good
+	if sim.Commands() != 2*models.MaxZone {
+		t.Errorf("expected %d commands, got %d", 2*models.MaxZone, sim.Commands())
+	}
+	if _, exists := b.connkeeper.connman.GetStatus(); exists {
+		t.Errorf("expected connection closed")
+	}
+}
+
+func TestBridgeRestoreLast(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	store, err := NewStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	on := models.On
+	off := models.Off
+	night := models.Night
+	hue := int(milight.Blue)
+	brightness := 32
+	err = store.Save(DefaultBridgeName, []models.LightState{
+		{Zone: 1, Switch: &on, Hue: &hue, Brightness: &brightness},
+		{Zone: 2, Switch: &off, Brightness: &brightness},
+		{Zone: 3, Switch: &night, Hue: &hue, Brightness: &brightness},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port, Restore: RestoreLast}, profile)
+	defer b.Close()
+
+	err = b.Restore(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := simulator.Bulb{Device: profile.Devices()[1], Linked: true, On: true, Hue: milight.Blue, Brightness: 32}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sim.Bulb(1) != expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if sim.Bulb(1) != expected {
+		t.Errorf("expected %+v, got %+v", expected, sim.Bulb(1))
+	}
+	if sim.Bulb(2).On || sim.Bulb(2).Brightness != 0 {
+		t.Errorf("expected bulb only switched off, got %+v", sim.Bulb(2))
+	}
+
+	// zones are restored in order, the night light is the last one and it's only switched on
+	deadline = time.Now().Add(2 * time.Second)
+	for !sim.Bulb(3).Night && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !sim.Bulb(3).Night || sim.Bulb(3).Brightness != 0 {
+		t.Errorf("expected bulb only in night light, got %+v", sim.Bulb(3))
+	}
+	if sim.Commands() != 5 {
+		t.Errorf("expected %d commands, got %d", 5, sim.Commands())
+	}
+}
+
+func TestLightFromState(t *testing.T) {
+	color := "red"
+	brightness := 10
+
+	for _, state := range []string{models.Off, models.Night} {
+		state := state
+		l := lightFromState(models.LightState{Zone: 2, Switch: &state, Color: &color, Brightness: &brightness})
+		if l.Zone != 2 || l.Switch == nil || *l.Switch != state || l.Color != nil || l.Brightness != nil {
+			t.Errorf("%s: expected switch only, got %s", state, l.String())
+		}
+	}
+}
+
+func TestDeviceError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected error
+	}{
+		{fmt.Errorf("%w: connection refused", errAllocateConnection), ErrBridgeUnavailable},
+		{milight.ErrInvalidResponse, ErrBridgeUnavailable},
+		{&net.OpError{Op: "read", Net: "udp", Err: testTimeoutError{}}, ErrBridgeTimeout},
+		{&net.OpError{Op: "read", Net: "udp", Err: errors.New("connection refused")}, ErrBridgeUnavailable},
+		{ibox.ErrUnsupportedCommand, ibox.ErrUnsupportedCommand},
+	}
+	for _, tc := range cases {
+		err := deviceError(tc.err)
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("%v: expected %v, got %v", tc.err, tc.expected, err)
+		}
+	}
+}
+
+type testTimeoutError struct{}
+
+func (testTimeoutError) Error() string   { return "i/o timeout" }
+func (testTimeoutError) Timeout() bool   { return true }
+func (testTimeoutError) Temporary() bool { return true }
+
+func testSimulator(t *testing.T, profile *Profile) *simulator.Simulator {
+	sim, err := simulator.Listen("127.0.0.1:0", profile.Devices())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+func testSimulatorAddr(t *testing.T, sim *simulator.Simulator) (string, int) {
+	host, port, err := net.SplitHostPort(sim.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iPort, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, iPort
+}
@@ -1,40 +1,57 @@
 package milightd
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
 	"time"
 
-	"github.com/sgrzywna/milight"
 	"github.com/sgrzywna/milightd/pkg/models"
 )
 
-const (
-	// waitForMilightTimeout is the delay between tries to communicate with Mi-Light device.
-	waitForMilightTimeout = 3 * time.Second
-	// commandsBufferSize is the size of commands channel.
-	commandsBufferSize = 3
-	// connectionTTL is the Mi-Light connection time to live.
-	connectionTTL = 30 * time.Second
-)
-
 var (
+	// ErrInvalidZone is returned when light control command addresses non-existing zone.
+	ErrInvalidZone = errors.New("invalid zone")
+	// ErrInvalidValue is returned when light control command contains value out of range.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrBridgeUnavailable is returned when synchronous command can't be executed because of bridge connection failure.
+	ErrBridgeUnavailable = errors.New("bridge unavailable")
+	// ErrBridgeTimeout is returned when bridge doesn't respond to synchronous command in time.
+	ErrBridgeTimeout = errors.New("bridge timeout")
 	// errAllocateConnection is returned when there is an error with Mi-Light connection allocation.
 	errAllocateConnection = errors.New("can't allocate connection")
+	// ErrBridgeBusy is returned when command can't be queued for execution before the deadline.
+	ErrBridgeBusy = errors.New("bridge busy")
 )
 
-// LightController represents API to control the light.
+// LightController represents API to control the light in the given zone.
 type LightController interface {
 	// On turns light on.
-	On() error
+	On(zone byte) error
 	// Off turns light off.
-	Off() error
+	Off(zone byte) error
+	// Night turns night light on.
+	Night(zone byte) error
 	// Color sets light color.
-	Color(color byte) error
+	Color(zone byte, color byte) error
 	// White sets white light.
-	White() error
+	White(zone byte) error
 	// Brightness sets brightness level.
-	Brightness(brightness byte) error
+	Brightness(zone byte, brightness byte) error
+	// Saturation sets color saturation level.
+	Saturation(zone byte, saturation byte) error
+	// Temperature sets white light temperature.
+	Temperature(zone byte, temperature byte) error
+	// Mode starts built-in effect mode.
+	Mode(zone byte, mode byte) error
+	// SpeedUp increases effect mode speed.
+	SpeedUp(zone byte) error
+	// SpeedDown decreases effect mode speed.
+	SpeedDown(zone byte) error
+	// Link pairs bulbs powered on within last few seconds with the zone.
+	Link(zone byte) error
+	// Unlink unpairs bulbs powered on within last few seconds from the zone.
+	Unlink(zone byte) error
 }
 
 // Command represents command to control Mi-Light device.
@@ -42,10 +59,31 @@ type Command interface {
 	Exec(LightController) error
 }
 
+// Priority represents light control command priority, higher priority commands are sent to the bridge first.
+type Priority int
+
+// Light control command priorities, from the highest one.
+const (
+	// PriorityAlert is the priority of alerts, they don't stop the running sequence.
+	PriorityAlert Priority = iota
+	// PriorityInteractive is the priority of API commands, they stop the running sequence.
+	PriorityInteractive
+	// PrioritySequence is the priority of sequence steps.
+	PrioritySequence
+	// priorities is the number of priorities.
+	priorities
+)
+
 // LightAPI represents light control interface.
 type LightAPI interface {
-	// Process processes light control command.
-	Process(bool, models.Light) bool
+	// Process processes light control command with the given priority.
+	Process(context.Context, Priority, models.Light) error
+}
+
+// SyncLightAPI represents light control interface waiting for command execution.
+type SyncLightAPI interface {
+	// ProcessSync processes light control command with the given priority and returns result of its execution.
+	ProcessSync(context.Context, Priority, models.Light) error
 }
 
 // SequenceAPI represents sequence control interface.
@@ -58,130 +96,222 @@ type SequenceAPI interface {
 	AddSequence(models.Sequence) error
 	// DeleteSequence deletes sequence.
 	DeleteSequence(string) error
-	// GetSequenceState returns state of the running sequence.
-	GetSequenceState() (*models.SequenceState, error)
-	// SetSequenceState control state of the running sequence.
+	// GetSequenceState returns state of the sequence running on the bridge.
+	GetSequenceState(string) (*models.SequenceState, error)
+	// SetSequenceState control state of the sequence running on the bridge.
 	SetSequenceState(models.SequenceState) (*models.SequenceState, error)
 }
 
+// LightStateAPI represents tracked light state interface.
+type LightStateAPI interface {
+	// GetLight returns state of the light in zones paired with the bridge.
+	GetLight(string) ([]models.LightState, error)
+}
+
+// ZoneAPI represents zone pairing interface.
+type ZoneAPI interface {
+	// Link pairs bulbs with the zone.
+	Link(int, models.Link) error
+	// Unlink unpairs bulbs from the zone.
+	Unlink(int, models.Link) error
+}
+
+// DeviceAPI represents devices description interface.
+type DeviceAPI interface {
+	// GetDevices returns description of the bulbs paired with all bridges.
+	GetDevices() ([]models.Device, error)
+}
+
+// DiagnosticsAPI represents diagnostics interface.
+type DiagnosticsAPI interface {
+	// GetBridges returns status of all bridge connections.
+	GetBridges() ([]models.BridgeStatus, error)
+	// GetFailedCommands returns the latest commands never executed by the bridge, all bridges are included when name is empty.
+	GetFailedCommands(string) ([]models.FailedCommand, error)
+}
+
+// HealthAPI represents readiness interface.
+type HealthAPI interface {
+	// Ready returns result of the readiness checks of the store and every bridge.
+	Ready() models.Health
+}
+
 // Controller represents milight controller interface.
 type Controller interface {
 	LightAPI
+	SyncLightAPI
+	LightStateAPI
+	ZoneAPI
+	DeviceAPI
+	DiagnosticsAPI
+	HealthAPI
 	SequenceAPI
 }
 
-// MilightController controls Mi-Light device.
+// MilightController controls Mi-Light devices.
 type MilightController struct {
-	addr       string
-	port       int
-	cmds       chan Command
-	sequencer  Sequencer
-	store      *SequenceStore
-	connkeeper *ConnectionKeeper
+	bridges *BridgeRegistry
+	store   *SequenceStore
+	states  *StateStore
 }
 
 // NewMilightController returns initialized MilightController object.
-func NewMilightController(addr string, port int, storeDir string) (*MilightController, error) {
+func NewMilightController(bridges []BridgeConfig, storeDir string) (*MilightController, error) {
 	store, err := NewSequenceStore(storeDir)
 	if err != nil {
 		return nil, err
 	}
-	connman := NewConnectionManager(addr, port)
-	connkeeper := NewConnectionKeeper(connman, connectionTTL)
+	states, err := NewStateStore(storeDir)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := NewBridgeRegistry(bridges)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range registry.Names() {
+		b, _ := registry.Get(name)
+		err = b.Restore(states, store)
+		if err != nil {
+			registry.Close()
+			return nil, fmt.Errorf("bridge %s: can't restore light state: %s", name, err)
+		}
+	}
 	c := MilightController{
-		addr:       addr,
-		port:       port,
-		cmds:       make(chan Command, commandsBufferSize),
-		store:      store,
-		connkeeper: connkeeper,
-	}
-	c.sequencer = NewSequenceProcessor(&c)
-	go c.loop()
+		bridges: registry,
+		store:   store,
+		states:  states,
+	}
 	return &c, nil
 }
 
 // Close terminates controller.
 func (m *MilightController) Close() {
-	m.sequencer.Stop()
-	close(m.cmds)
-	m.connkeeper.Terminate()
+	m.bridges.Close()
 }
 
 // Process processes light control command.
-func (m *MilightController) Process(fromSequence bool, l models.Light) bool {
-	if !fromSequence {
-		m.sequencer.Stop()
+func (m *MilightController) Process(ctx context.Context, p Priority, l models.Light) error {
+	b, err := m.bridges.Get(l.Bridge)
+	if err != nil {
+		return err
 	}
+	return b.Process(ctx, p, l)
+}
 
-	res := true
-
-	if l.Switch != nil {
-		log.Printf("milightd light switch %s", *l.Switch)
-		if !m.exec(&LightSwitch{on: *l.Switch}) {
-			res = false
-			log.Printf("milightd light switch %s failed", *l.Switch)
-		}
+// ProcessSync processes light control command and returns result of its execution.
+func (m *MilightController) ProcessSync(ctx context.Context, p Priority, l models.Light) error {
+	b, err := m.bridges.Get(l.Bridge)
+	if err != nil {
+		return err
 	}
+	return b.ProcessSync(ctx, p, l)
+}
 
-	if l.Brightness != nil {
-		log.Printf("milightd brightness %d", *l.Brightness)
-		if !m.exec(&LightBrightness{level: *l.Brightness}) {
-			res = false
-			log.Printf("milightd brightness %d failed", *l.Brightness)
-		}
+// GetLight returns state of the light in zones paired with the bridge.
+func (m *MilightController) GetLight(bridge string) ([]models.LightState, error) {
+	b, err := m.bridges.Get(bridge)
+	if err != nil {
+		return nil, err
 	}
+	return b.State(), nil
+}
 
-	if l.Color != nil {
-		log.Printf("milightd color %s", *l.Color)
-		if !m.exec(&LightColor{color: *l.Color}) {
-			res = false
-			log.Printf("milightd color %s failed", *l.Color)
-		}
+// Link pairs bulbs with the zone.
+func (m *MilightController) Link(zone int, l models.Link) error {
+	b, err := m.bridges.Get(l.Bridge)
+	if err != nil {
+		return err
 	}
+	return b.Link(zone, l.Duration, false)
+}
 
-	return res
+// Unlink unpairs bulbs from the zone.
+func (m *MilightController) Unlink(zone int, l models.Link) error {
+	b, err := m.bridges.Get(l.Bridge)
+	if err != nil {
+		return err
+	}
+	return b.Link(zone, l.Duration, true)
 }
 
-// exec executes command.
-func (m *MilightController) exec(c Command) bool {
-	select {
-	case m.cmds <- c:
-		return true
-	default:
-		return false
+// GetDevices returns description of the bulbs paired with all bridges.
+func (m *MilightController) GetDevices() ([]models.Device, error) {
+	devices := make([]models.Device, 0)
+	for _, name := range m.bridges.Names() {
+		b, err := m.bridges.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, b.Devices()...)
 	}
+	return devices, nil
 }
 
-// loop is the main processing loop.
-func (m *MilightController) loop() {
-	log.Printf("milight controller loop started")
-	defer log.Printf("milight controller loop terminated")
+// GetBridges returns status of all bridge connections.
+func (m *MilightController) GetBridges() ([]models.BridgeStatus, error) {
+	statuses := make([]models.BridgeStatus, 0)
+	for _, name := range m.bridges.Names() {
+		b, err := m.bridges.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, b.Status())
+	}
+	return statuses, nil
+}
 
-	for {
-		cmd, ok := <-m.cmds
-		if !ok {
-			return
+// GetFailedCommands returns the latest commands never executed by the bridge, all bridges are included when name is empty.
+func (m *MilightController) GetFailedCommands(bridge string) ([]models.FailedCommand, error) {
+	names := m.bridges.Names()
+	if bridge != "" {
+		names = []string{bridge}
+	}
+	commands := make([]models.FailedCommand, 0)
+	for _, name := range names {
+		b, err := m.bridges.Get(name)
+		if err != nil {
+			return nil, err
 		}
-		err := m.processCommand(cmd)
+		commands = append(commands, b.FailedCommands()...)
+	}
+	return commands, nil
+}
+
+// Ready returns result of the readiness checks of the store and every bridge, it's ready only when all checks pass.
+func (m *MilightController) Ready() models.Health {
+	checks := []models.Check{m.checkStore()}
+	for _, name := range m.bridges.Names() {
+		b, err := m.bridges.Get(name)
 		if err != nil {
-			if err == errAllocateConnection || err == milight.ErrInvalidResponse {
-				time.Sleep(waitForMilightTimeout)
-				continue
-			}
-			log.Printf("milight command error: %s", err)
+			continue
 		}
+		checks = append(checks, b.Ready()...)
 	}
+	status := models.HealthOK
+	for _, c := range checks {
+		if c.Status != models.HealthOK {
+			status = models.HealthFailed
+		}
+	}
+	return models.Health{Status: status, Checks: checks}
 }
 
-// processCommand allocates connection to Mi-Light device and executes command.
-func (m *MilightController) processCommand(cmd Command) error {
-	ml, err := m.connkeeper.Allocate()
+// checkStore checks whether sequences and light state of every bridge can be read from the store.
+func (m *MilightController) checkStore() models.Check {
+	c := models.Check{Name: models.CheckStore, Status: models.HealthOK}
+	_, err := m.store.GetAll()
+	for _, name := range m.bridges.Names() {
+		if err != nil {
+			break
+		}
+		_, err = m.states.Load(name)
+	}
 	if err != nil {
-		log.Printf("can't allocate milight device: %s", err)
-		return errAllocateConnection
+		c.Status = models.HealthFailed
+		c.Detail = err.Error()
 	}
-	defer m.connkeeper.Release()
-	return cmd.Exec(ml)
+	return c
 }
 
 // GetSequences returns list of defined sequences.
@@ -196,39 +326,115 @@ func (m *MilightController) GetSequence(name string) (*models.Sequence, error) {
 
 // AddSequence adds sequence.
 func (m *MilightController) AddSequence(seq models.Sequence) error {
+	err := validateSequence(seq)
+	if err != nil {
+		return err
+	}
 	return m.store.Add(seq)
 }
 
+// validateSequence checks sequence playback parameters and step transitions.
+func validateSequence(seq models.Sequence) error {
+	if seq.Repeat < 0 {
+		return fmt.Errorf("%w: negative repeat count %d", ErrInvalidValue, seq.Repeat)
+	}
+	for i, step := range seq.Steps {
+		if step.Transition < 0 {
+			return fmt.Errorf("%w: negative transition %d of step %d", ErrInvalidValue, step.Transition, i)
+		}
+	}
+	switch seq.End {
+	case "", models.SeqEndStop, models.SeqEndOff, models.SeqEndRestore:
+	case models.SeqEndChain:
+		if seq.Next == "" {
+			return fmt.Errorf("%w: missing name of the chained sequence", ErrInvalidValue)
+		}
+	default:
+		return fmt.Errorf("%w: unknown end action %s", ErrInvalidValue, seq.End)
+	}
+	return nil
+}
+
 // DeleteSequence deletes sequence.
 func (m *MilightController) DeleteSequence(name string) error {
 	return m.store.Remove(name)
 }
 
-// GetSequenceState returns state of the running sequence.
-func (m *MilightController) GetSequenceState() (*models.SequenceState, error) {
+// GetSequenceState returns state of the sequence running on the bridge.
+func (m *MilightController) GetSequenceState(bridge string) (*models.SequenceState, error) {
+	b, err := m.bridges.Get(bridge)
+	if err != nil {
+		return nil, err
+	}
 	var state models.SequenceState
-	sts := m.sequencer.Status()
-	if sts != nil {
-		state.Name = sts.Name
+	state.Bridge = b.Name()
+	// sequence may stop or change meanwhile, so the state is taken at once
+	snapshot := b.sequencer.Snapshot()
+	if snapshot.Sequence != nil {
+		state.Name = snapshot.Sequence.Name
 		state.State = models.SeqRunning
+		state.Progress = snapshot.Progress
+		if snapshot.Paused {
+			state.State = models.SeqPaused
+		}
 	} else {
 		state.State = models.SeqStopped
+		state.Reason = snapshot.Reason
 	}
 	return &state, nil
 }
 
-// SetSequenceState control state of the running sequence.
+// SetSequenceState control state of the sequence running on the bridge.
 func (m *MilightController) SetSequenceState(state models.SequenceState) (*models.SequenceState, error) {
+	b, err := m.bridges.Get(state.Bridge)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Action != "" {
+		err = m.controlSequence(b, state)
+		if err != nil {
+			return nil, err
+		}
+		return m.GetSequenceState(b.Name())
+	}
+
 	switch state.State {
 	case models.SeqRunning:
+		// paused sequence continues from the current step, other one starts from the beginning or the offset
+		if seq := b.sequencer.Status(); seq != nil && b.sequencer.Paused() && state.Offset == 0 && (state.Name == "" || state.Name == seq.Name) {
+			b.sequencer.Resume()
+			break
+		}
+		if state.Offset < 0 {
+			return nil, fmt.Errorf("%w: negative offset %d", ErrInvalidValue, state.Offset)
+		}
 		seq, err := m.store.Get(state.Name)
 		if err != nil {
 			return nil, err
 		}
-		m.sequencer.Start(seq)
+		b.sequencer.StartAt(seq, time.Duration(state.Offset)*time.Millisecond)
+	case models.SeqPaused:
+		b.sequencer.Pause()
 	default:
-		m.sequencer.Stop()
+		b.sequencer.Stop()
 	}
 
-	return m.GetSequenceState()
+	return m.GetSequenceState(b.Name())
+}
+
+// controlSequence executes playback control action of the running sequence.
+func (m *MilightController) controlSequence(b *Bridge, state models.SequenceState) error {
+	switch state.Action {
+	case models.SeqSeek:
+		if state.Step == nil {
+			return fmt.Errorf("%w: missing step of the seek action", ErrInvalidValue)
+		}
+		return b.sequencer.Seek(*state.Step)
+	case models.SeqNext:
+		return b.sequencer.Skip(1)
+	case models.SeqPrevious:
+		return b.sequencer.Skip(-1)
+	}
+	return fmt.Errorf("%w: unknown sequence action %s", ErrInvalidValue, state.Action)
 }
@@ -0,0 +1,160 @@
+package milightd
+
+import (
+	"math"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+// level represents zone hue and brightness set by light control commands, nil fields are unknown.
+type level struct {
+	// color is set when the command sets color, hue is nil for white light then.
+	color      bool
+	hue        *int
+	brightness *int
+}
+
+// lightLevel returns hue and brightness set by the light control command.
+func lightLevel(l models.Light) level {
+	var lv level
+	if l.Color != nil {
+		lv.color = true
+		setting, err := parseColor(*l.Color)
+		if err == nil {
+			if !setting.white {
+				hue := int(setting.hue)
+				lv.hue = &hue
+			}
+			lv.brightness = setting.brightness
+		}
+	}
+	if l.Hue != nil {
+		lv.color = true
+		hue := *l.Hue
+		lv.hue = &hue
+	}
+	if l.Brightness != nil {
+		brightness := *l.Brightness
+		lv.brightness = &brightness
+	}
+	return lv
+}
+
+// update returns level changed by the next light control command.
+func (lv level) update(next level) level {
+	if next.color {
+		lv.color = true
+		lv.hue = next.hue
+	}
+	if next.brightness != nil {
+		lv.brightness = next.brightness
+	}
+	return lv
+}
+
+// fade represents transition of the zone hue and brightness towards the sequence step.
+// Intermediate frames are sent every interval, the final one at the end of the transition sets the step hue and brightness exactly.
+type fade struct {
+	zone       int
+	from       level
+	to         level
+	final      models.Light
+	interval   time.Duration
+	transition time.Duration
+	frames     int
+	frame      int
+}
+
+// newFade returns fade from the current zone level to the step light, it returns nil when there is nothing to fade.
+// Hue and brightness are faded only when both current and target values are known.
+func newFade(from level, step models.Light, interval, transition time.Duration) *fade {
+	if interval <= 0 || transition <= interval {
+		return nil
+	}
+	if step.Switch != nil && *step.Switch != models.On {
+		return nil
+	}
+	to := lightLevel(step)
+	f := fade{
+		zone:       step.Zone,
+		interval:   interval,
+		transition: transition,
+		frames:     int((transition + interval - 1) / interval),
+	}
+	f.final.Zone = step.Zone
+	if from.hue != nil && to.hue != nil {
+		f.from.hue, f.to.hue = from.hue, to.hue
+		f.final.Color, f.final.Hue = step.Color, step.Hue
+	}
+	if from.brightness != nil && to.brightness != nil {
+		f.from.brightness, f.to.brightness = from.brightness, to.brightness
+		f.final.Brightness = step.Brightness
+		if f.final.Brightness == nil {
+			f.final.Brightness = to.brightness
+		}
+	}
+	if f.to.hue == nil && f.to.brightness == nil {
+		return nil
+	}
+	return &f
+}
+
+// start returns the step light without faded fields, sent when the transition starts.
+// It returns false when there is nothing left to send.
+func (f *fade) start(step models.Light) (models.Light, bool) {
+	if f.to.hue != nil {
+		step.Color, step.Hue = nil, nil
+	}
+	if f.to.brightness != nil {
+		step.Brightness = nil
+		if step.Color != nil {
+			// brightness derived from color specification keeps the current one until the fade ends
+			step.Brightness = f.from.brightness
+		}
+	}
+	empty := step.Switch == nil && step.Color == nil && step.Hue == nil && step.Saturation == nil &&
+		step.Kelvin == nil && step.Brightness == nil && step.Mode == nil && step.Speed == nil
+	return step, !empty
+}
+
+// next returns light of the next frame and delay until the following one, it returns true for the final frame.
+func (f *fade) next() (models.Light, time.Duration, bool) {
+	f.frame++
+	if f.frame >= f.frames {
+		return f.final, 0, true
+	}
+	fraction := float64(time.Duration(f.frame)*f.interval) / float64(f.transition)
+	l := models.Light{Zone: f.zone}
+	if f.to.hue != nil {
+		hue := interpolateHue(*f.from.hue, *f.to.hue, fraction)
+		l.Hue = &hue
+	}
+	if f.to.brightness != nil {
+		brightness := interpolate(*f.from.brightness, *f.to.brightness, fraction)
+		l.Brightness = &brightness
+	}
+	delay := f.interval
+	if f.frame == f.frames-1 {
+		delay = f.transition - time.Duration(f.frame)*f.interval
+	}
+	return l, delay, false
+}
+
+// interpolate returns value between from and to.
+func interpolate(from, to int, fraction float64) int {
+	return from + int(math.Round(float64(to-from)*fraction))
+}
+
+// interpolateHue returns hue between from and to on the shortest path around the color wheel.
+func interpolateHue(from, to int, fraction float64) int {
+	span := models.MaxHue + 1
+	d := to - from
+	if d > span/2 {
+		d -= span
+	} else if d < -span/2 {
+		d += span
+	}
+	hue := from + int(math.Round(float64(d)*fraction))
+	return (hue%span + span) % span
+}
@@ -0,0 +1,89 @@
+package milightd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestInterpolateHue(t *testing.T) {
+	cases := []struct {
+		from     int
+		to       int
+		fraction float64
+		expected int
+	}{
+		{from: 10, to: 50, fraction: 0.5, expected: 30},
+		{from: 50, to: 10, fraction: 0.25, expected: 40},
+		{from: 250, to: 10, fraction: 0.5, expected: 2},
+		{from: 10, to: 250, fraction: 0.5, expected: 2},
+		{from: 0, to: 128, fraction: 1, expected: 128},
+	}
+	for _, tc := range cases {
+		hue := interpolateHue(tc.from, tc.to, tc.fraction)
+		if hue != tc.expected {
+			t.Errorf("%d -> %d at %.2f: expected %d, got %d", tc.from, tc.to, tc.fraction, tc.expected, hue)
+		}
+	}
+}
+
+func TestFade(t *testing.T) {
+	hue := 100
+	brightness := 60
+	on := models.On
+
+	from := lightLevel(models.Light{Hue: intPtr(50), Brightness: intPtr(20)})
+	step := models.Light{Zone: 2, Switch: &on, Hue: &hue, Brightness: &brightness}
+
+	f := newFade(from, step, 100*time.Millisecond, 250*time.Millisecond)
+	if f == nil {
+		t.Fatal("expected fade")
+	}
+
+	start, ok := f.start(step)
+	if !ok || !reflect.DeepEqual(start, models.Light{Zone: 2, Switch: &on}) {
+		t.Errorf("expected switch only at start, got %v", start)
+	}
+
+	expected := []struct {
+		light models.Light
+		delay time.Duration
+		final bool
+	}{
+		{light: models.Light{Zone: 2, Hue: intPtr(70), Brightness: intPtr(36)}, delay: 100 * time.Millisecond},
+		{light: models.Light{Zone: 2, Hue: intPtr(90), Brightness: intPtr(52)}, delay: 50 * time.Millisecond},
+		{light: models.Light{Zone: 2, Hue: &hue, Brightness: &brightness}, final: true},
+	}
+	for i, e := range expected {
+		light, delay, final := f.next()
+		if !reflect.DeepEqual(e.light, light) || e.delay != delay || e.final != final {
+			t.Errorf("frame %d: expected %v %s %t, got %v %s %t", i, e.light, e.delay, e.final, light, delay, final)
+		}
+	}
+}
+
+func TestFadeNothing(t *testing.T) {
+	off := models.Off
+	white := "white"
+
+	cases := []struct {
+		from level
+		step models.Light
+	}{
+		{from: level{}, step: models.Light{Brightness: intPtr(10)}},
+		{from: lightLevel(models.Light{Brightness: intPtr(20)}), step: models.Light{Switch: &off, Brightness: intPtr(10)}},
+		{from: lightLevel(models.Light{Hue: intPtr(20)}), step: models.Light{Color: &white}},
+	}
+	for _, tc := range cases {
+		f := newFade(tc.from, tc.step, 100*time.Millisecond, time.Second)
+		if f != nil {
+			t.Errorf("%v: expected no fade, got %+v", tc.step, f)
+		}
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,91 @@
+package milightd
+
+import (
+	"fmt"
+
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+// Profile describes bulb types paired with the bridge zones.
+type Profile struct {
+	bulbs        [models.MaxZone + 1]string
+	capabilities [models.MaxZone + 1]models.Capabilities
+}
+
+// NewProfile returns profile with the default bulb type and bulb types overridden per zone,
+// with features available through the bridge protocol.
+func NewProfile(protocol string, bulb string, zones map[int]string) (*Profile, error) {
+	if protocol != "" && protocol != ProtocolV6 && protocol != ProtocolLegacy {
+		return nil, fmt.Errorf("unknown protocol %s", protocol)
+	}
+	if bulb == "" {
+		bulb = BulbBridgeLamp
+		if protocol == ProtocolLegacy {
+			bulb = BulbRGBW
+		}
+	}
+	if _, ok := bulbTypes[bulb]; !ok {
+		return nil, fmt.Errorf("unknown bulb type %s", bulb)
+	}
+	var p Profile
+	for zone := range p.bulbs {
+		p.bulbs[zone] = bulb
+	}
+	for zone, bulb := range zones {
+		if zone <= models.ZoneAll || zone > models.MaxZone {
+			return nil, fmt.Errorf("invalid zone %d", zone)
+		}
+		if _, ok := bulbTypes[bulb]; !ok {
+			return nil, fmt.Errorf("zone %d: unknown bulb type %s", zone, bulb)
+		}
+		p.bulbs[zone] = bulb
+	}
+	for zone, bulb := range p.bulbs {
+		caps := bulbTypes[bulb].capabilities
+		if protocol == ProtocolLegacy {
+			var ok bool
+			caps, ok = legacyCapabilities[bulb]
+			if !ok {
+				return nil, fmt.Errorf("bulb type %s not supported by %s protocol", bulb, protocol)
+			}
+		}
+		p.capabilities[zone] = caps
+	}
+	return &p, nil
+}
+
+// Bulb returns type of the bulbs paired with the zone, for all zones it's the default bulb type.
+func (p *Profile) Bulb(zone int) string {
+	return p.bulbs[zone]
+}
+
+// Capabilities returns features supported in the zone.
+// When all zones are addressed, feature is supported if any zone supports it.
+func (p *Profile) Capabilities(zone int) models.Capabilities {
+	if zone != models.ZoneAll {
+		return p.capabilities[zone]
+	}
+	var c models.Capabilities
+	for _, bc := range p.capabilities[models.ZoneAll+1:] {
+		c.Switch = c.Switch || bc.Switch
+		c.Brightness = c.Brightness || bc.Brightness
+		c.Color = c.Color || bc.Color
+		c.White = c.White || bc.White
+		c.Saturation = c.Saturation || bc.Saturation
+		c.Kelvin = c.Kelvin || bc.Kelvin
+		c.Modes = c.Modes || bc.Modes
+		c.Night = c.Night || bc.Night
+		c.Link = c.Link || bc.Link
+	}
+	return c
+}
+
+// Devices returns types of the devices paired with zones.
+func (p *Profile) Devices() ibox.Zones {
+	var zones ibox.Zones
+	for zone, bulb := range p.bulbs {
+		zones[zone] = bulbTypes[bulb].device
+	}
+	return zones
+}
@@ -0,0 +1,224 @@
+package milightd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// errCommandsQueueClosed is returned when command is queued after the bridge was closed.
+	errCommandsQueueClosed = errors.New("commands queue closed")
+)
+
+// commandKey identifies zone property set by the command.
+type commandKey struct {
+	property string
+	zone     byte
+}
+
+// coalesceKey returns zone property set by the command, commands changing the property relatively can't be coalesced.
+func coalesceKey(c Command) (commandKey, bool) {
+	switch c := c.(type) {
+	case *LightSwitch:
+		return commandKey{"switch", c.zone}, true
+	case *LightBrightness:
+		return commandKey{"brightness", c.zone}, true
+	case *LightColor:
+		return commandKey{"color", c.zone}, true
+	case *LightHue:
+		return commandKey{"color", c.zone}, true
+	case *LightSaturation:
+		return commandKey{"saturation", c.zone}, true
+	case *LightTemperature:
+		return commandKey{"temperature", c.zone}, true
+	case *LightMode:
+		return commandKey{"mode", c.zone}, true
+	}
+	return commandKey{}, false
+}
+
+// commandQueue is the bridge commands queue with separate lane for every command priority.
+// Jobs are taken from the highest priority lane first, lanes hold up to the same number of jobs.
+// Queued command supersedes pending commands of the same or lower priority setting the same zone property,
+// so only the newest value is sent to the bridge. Jobs waiting for result are never superseded.
+type commandQueue struct {
+	lanes  [priorities][]job
+	size   int
+	closed bool
+	cond   *sync.Cond
+	mux    sync.Mutex
+}
+
+// newCommandQueue returns queue holding up to size pending jobs in every lane, callers wait for free place in the full lane.
+func newCommandQueue(size int) *commandQueue {
+	q := commandQueue{
+		size: size,
+	}
+	q.cond = sync.NewCond(&q.mux)
+	return &q
+}
+
+// push queues job in the priority lane, superseded pending jobs are dropped.
+// It waits for free place in the full lane until the context is done, jobs are superseded only when the job is queued.
+func (q *commandQueue) push(ctx context.Context, p Priority, j job) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed {
+		return errCommandsQueueClosed
+	}
+
+	cmds := commandList{j.cmd}
+	if l, ok := j.cmd.(commandList); ok {
+		cmds = l
+	}
+	var keys []commandKey
+	for _, c := range cmds {
+		if key, ok := coalesceKey(c); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	if !q.room(p, keys) {
+		stop := q.wakeOnDone(ctx)
+		defer close(stop)
+		for !q.room(p, keys) && !q.closed && ctx.Err() == nil {
+			q.cond.Wait()
+		}
+	}
+
+	switch {
+	case q.closed:
+		return errCommandsQueueClosed
+	case !q.room(p, keys):
+		return fmt.Errorf("%w: %s", ErrBridgeBusy, ctx.Err())
+	}
+
+	for _, key := range keys {
+		q.supersede(p, key)
+	}
+	q.lanes[p] = append(q.lanes[p], j)
+	q.cond.Broadcast()
+
+	return nil
+}
+
+// room checks whether the priority lane has free place for the job, counting place of jobs it supersedes.
+func (q *commandQueue) room(p Priority, keys []commandKey) bool {
+	n := 0
+	for _, j := range q.lanes[p] {
+		if !superseded(j, keys) {
+			n++
+		}
+	}
+	return n < q.size
+}
+
+// superseded checks whether pending job is superseded by commands setting the zone properties.
+func superseded(j job, keys []commandKey) bool {
+	if j.done != nil {
+		return false
+	}
+	k, ok := coalesceKey(j.cmd)
+	if !ok {
+		return false
+	}
+	for _, key := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// wakeOnDone wakes up waiting callers when the context is done, until stop channel is closed.
+func (q *commandQueue) wakeOnDone(ctx context.Context) chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			q.mux.Lock()
+			q.cond.Broadcast()
+			q.mux.Unlock()
+		case <-stop:
+		}
+	}()
+	return stop
+}
+
+// pushIdle queues job in the lowest priority lane only when no other job is pending, it doesn't supersede any job.
+func (q *commandQueue) pushIdle(j job) bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed || q.pending() > 0 {
+		return false
+	}
+
+	q.lanes[priorities-1] = append(q.lanes[priorities-1], j)
+	q.cond.Broadcast()
+
+	return true
+}
+
+// supersede drops pending single commands of the same or lower priority setting the zone property.
+func (q *commandQueue) supersede(p Priority, key commandKey) {
+	for lane := p; lane < priorities; lane++ {
+		jobs := q.lanes[lane][:0]
+		for _, j := range q.lanes[lane] {
+			if superseded(j, []commandKey{key}) {
+				continue
+			}
+			jobs = append(jobs, j)
+		}
+		q.lanes[lane] = jobs
+	}
+}
+
+// usage returns number of jobs in the priority lane and the lane size.
+func (q *commandQueue) usage(p Priority) (int, int) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.lanes[p]), q.size
+}
+
+// pending returns number of jobs in all lanes.
+func (q *commandQueue) pending() int {
+	n := 0
+	for _, jobs := range q.lanes {
+		n += len(jobs)
+	}
+	return n
+}
+
+// pop returns the oldest job from the highest priority lane, waiting until one is queued.
+// It returns false when queue is closed and drained.
+func (q *commandQueue) pop() (job, bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	for q.pending() == 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	for lane, jobs := range q.lanes {
+		if len(jobs) == 0 {
+			continue
+		}
+		q.lanes[lane] = jobs[1:]
+		q.cond.Broadcast()
+		return jobs[0], true
+	}
+
+	return job{}, false
+}
+
+// close closes queue, pending jobs are still returned.
+func (q *commandQueue) close() {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
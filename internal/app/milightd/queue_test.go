@@ -0,0 +1,167 @@
+package milightd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommandQueueCoalesce(t *testing.T) {
+	q := newCommandQueue(4)
+
+	for level := 0; level < 30; level++ {
+		err := q.push(context.Background(), PriorityInteractive, job{cmd: &LightBrightness{zone: 1, level: level}})
+		if err != nil {
+			t.Fatalf("brightness %d: %s", level, err)
+		}
+	}
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightColor{zone: 1, color: "red"}})
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightBrightness{zone: 2, level: 10}})
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightHue{zone: 1, hue: 10}})
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightSpeed{zone: 1, speed: "up"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := q.push(ctx, PriorityInteractive, job{cmd: &LightSpeed{zone: 1, speed: "up"}})
+	if !errors.Is(err, ErrBridgeBusy) {
+		t.Errorf("expected %v, got %v", ErrBridgeBusy, err)
+	}
+
+	q.close()
+
+	expected := []Command{
+		&LightBrightness{zone: 1, level: 29},
+		&LightBrightness{zone: 2, level: 10},
+		&LightHue{zone: 1, hue: 10},
+		&LightSpeed{zone: 1, speed: "up"},
+	}
+
+	if cmds := testDrain(q); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %v, got %v", expected, cmds)
+	}
+}
+
+func TestCommandQueueSync(t *testing.T) {
+	q := newCommandQueue(3)
+
+	done := make(chan error, 1)
+
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightSwitch{zone: 1, on: "on"}})
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightSwitch{zone: 2, on: "on"}, done: done})
+	q.push(context.Background(), PriorityInteractive, job{cmd: commandList{&LightSwitch{zone: 1, on: "off"}, &LightSwitch{zone: 2, on: "off"}}})
+	q.close()
+
+	expected := []Command{
+		&LightSwitch{zone: 2, on: "on"},
+		commandList{&LightSwitch{zone: 1, on: "off"}, &LightSwitch{zone: 2, on: "off"}},
+	}
+
+	if cmds := testDrain(q); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %v, got %v", expected, cmds)
+	}
+}
+
+func TestCommandQueuePushIdle(t *testing.T) {
+	q := newCommandQueue(3)
+
+	if !q.pushIdle(job{cmd: &LightSwitch{zone: 1, on: "on"}}) {
+		t.Errorf("expected job queued in empty queue")
+	}
+	if q.pushIdle(job{cmd: &LightSwitch{zone: 2, on: "on"}}) {
+		t.Errorf("expected job not queued in busy queue")
+	}
+
+	q.close()
+
+	err := q.push(context.Background(), PriorityInteractive, job{cmd: &LightSwitch{zone: 2, on: "on"}})
+	if !errors.Is(err, errCommandsQueueClosed) {
+		t.Errorf("expected %v, got %v", errCommandsQueueClosed, err)
+	}
+	if len(testDrain(q)) != 1 {
+		t.Errorf("expected pending job returned after close")
+	}
+}
+
+func TestCommandQueuePriority(t *testing.T) {
+	q := newCommandQueue(4)
+
+	q.push(context.Background(), PrioritySequence, job{cmd: &LightBrightness{zone: 1, level: 10}})
+	q.push(context.Background(), PrioritySequence, job{cmd: &LightColor{zone: 1, color: "red"}})
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightSwitch{zone: 1, on: "off"}})
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightBrightness{zone: 1, level: 20}})
+	q.push(context.Background(), PrioritySequence, job{cmd: &LightBrightness{zone: 1, level: 30}})
+	q.push(context.Background(), PriorityAlert, job{cmd: &LightColor{zone: 2, color: "blue"}})
+	q.close()
+
+	expected := []Command{
+		&LightColor{zone: 2, color: "blue"},
+		&LightSwitch{zone: 1, on: "off"},
+		&LightBrightness{zone: 1, level: 20},
+		&LightColor{zone: 1, color: "red"},
+		&LightBrightness{zone: 1, level: 30},
+	}
+
+	if cmds := testDrain(q); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %v, got %v", expected, cmds)
+	}
+}
+
+func TestCommandQueueWait(t *testing.T) {
+	q := newCommandQueue(1)
+
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightSpeed{zone: 1, speed: "up"}})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.pop()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := q.push(ctx, PriorityInteractive, job{cmd: &LightSpeed{zone: 1, speed: "down"}})
+	if err != nil {
+		t.Errorf("expected job queued after free place, got %v", err)
+	}
+}
+
+func TestCommandQueueBusyKeepsPending(t *testing.T) {
+	q := newCommandQueue(1)
+
+	q.push(context.Background(), PrioritySequence, job{cmd: &LightBrightness{zone: 1, level: 10}})
+	q.push(context.Background(), PriorityInteractive, job{cmd: &LightSwitch{zone: 2, on: "on"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// full interactive lane times out, pending sequence command of the same zone property stays
+	err := q.push(ctx, PriorityInteractive, job{cmd: &LightBrightness{zone: 1, level: 20}})
+	if !errors.Is(err, ErrBridgeBusy) {
+		t.Errorf("expected %v, got %v", ErrBridgeBusy, err)
+	}
+
+	q.close()
+
+	expected := []Command{
+		&LightSwitch{zone: 2, on: "on"},
+		&LightBrightness{zone: 1, level: 10},
+	}
+
+	if cmds := testDrain(q); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %v, got %v", expected, cmds)
+	}
+}
+
+func testDrain(q *commandQueue) []Command {
+	var cmds []Command
+	for {
+		j, ok := q.pop()
+		if !ok {
+			return cmds
+		}
+		cmds = append(cmds, j.cmd)
+	}
+}
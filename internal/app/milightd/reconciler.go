@@ -0,0 +1,133 @@
+package milightd
+
+import (
+	"log"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+// Reconciler re-sends the last light state to the bridge zones, as bulbs miss some of the UDP commands.
+// State is re-sent periodically and after the bridge connection is re-established.
+// Zones driven by the running sequence are left alone.
+type Reconciler struct {
+	bridge      *Bridge
+	interval    time.Duration
+	reconnected <-chan struct{}
+	terminate   chan struct{}
+}
+
+// NewReconciler returns initialized Reconciler object.
+func NewReconciler(bridge *Bridge, interval time.Duration, reconnected <-chan struct{}) *Reconciler {
+	r := Reconciler{
+		bridge:      bridge,
+		interval:    interval,
+		reconnected: reconnected,
+		terminate:   make(chan struct{}),
+	}
+	go r.loop()
+	return &r
+}
+
+// Terminate terminates reconciler loop.
+func (r *Reconciler) Terminate() {
+	r.terminate <- struct{}{}
+	<-r.terminate
+}
+
+// Reconcile queues job re-sending the last light state to zones not driven by the running sequence.
+func (r *Reconciler) Reconcile() {
+	if r.bridge.breaker.Available() != nil {
+		return
+	}
+
+	// pending commands are newer than the last light state
+	if !r.bridge.cmds.pushIdle(job{cmd: reconcileCommand{r}}) {
+		log.Printf("milightd %s reconcile skipped, bridge busy", r.bridge.name)
+	}
+}
+
+// reconcileCommand represents commands re-sending the last light state.
+// They're built when the job is executed, so the state includes all commands executed before.
+type reconcileCommand struct {
+	r *Reconciler
+}
+
+// Exec executes commands re-sending the last light state.
+func (c reconcileCommand) Exec(lc LightController) error {
+	return c.r.commands().Exec(lc)
+}
+
+// String implements string representation of the command.
+func (c reconcileCommand) String() string {
+	return "reconcile"
+}
+
+// commands returns commands re-sending the last light state to zones not driven by the running sequence.
+func (r *Reconciler) commands() commandList {
+	driven := r.bridge.sequenceZones()
+
+	var cmds commandList
+
+	for _, state := range r.bridge.State() {
+		if driven[state.Zone] {
+			continue
+		}
+		c, err := r.bridge.commands(lightFromState(state))
+		if err != nil {
+			log.Printf("milightd %s can't reconcile zone %d: %s", r.bridge.name, state.Zone, err)
+			continue
+		}
+		cmds = append(cmds, c...)
+	}
+
+	if len(cmds) > 0 {
+		log.Printf("milightd %s reconcile %s", r.bridge.name, cmds)
+	}
+	return cmds
+}
+
+// loop is the reconciler main loop.
+func (r *Reconciler) loop() {
+	log.Printf("milightd %s reconciler loop started", r.bridge.name)
+	defer log.Printf("milightd %s reconciler loop terminated", r.bridge.name)
+	defer func() { r.terminate <- struct{}{} }()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.terminate:
+			return
+		case <-ticker.C:
+			r.Reconcile()
+		case <-r.reconnected:
+			r.Reconcile()
+		}
+	}
+}
+
+// sequenceZones returns zones driven by the running sequence.
+func (b *Bridge) sequenceZones() map[int]bool {
+	seq := b.sequencer.Status()
+	if seq == nil {
+		return make(map[int]bool)
+	}
+	return sequenceZones(seq)
+}
+
+// sequenceZones returns zones driven by the sequence.
+func sequenceZones(seq *models.Sequence) map[int]bool {
+	zones := make(map[int]bool)
+	for _, step := range seq.Steps {
+		if step.Light.Zone == models.ZoneAll {
+			for zone := models.ZoneAll + 1; zone <= models.MaxZone; zone++ {
+				zones[zone] = true
+			}
+			continue
+		}
+		zones[step.Light.Zone] = true
+	}
+	return zones
+}
@@ -0,0 +1,202 @@
+package milightd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+	"github.com/sgrzywna/milightd/internal/pkg/simulator"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestReconciler(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port, ReconcileInterval: 100}, profile)
+	defer b.Close()
+
+	l := models.Light{}
+	l.SetZone(1)
+	l.SetSwitch(true)
+	l.SetHue(int(milight.Blue))
+	l.SetBrightness(32)
+
+	err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := *b.State()[0].Changed.Switch
+
+	// bulb drifts away from the commanded state
+	other, err := ibox.NewBridge(host, port, profile.Devices())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	err = other.Off(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := simulator.Bulb{Device: profile.Devices()[1], Linked: true, On: true, Hue: milight.Blue, Brightness: 32}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sim.Bulb(1) != expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if sim.Bulb(1) != expected {
+		t.Errorf("expected %+v, got %+v", expected, sim.Bulb(1))
+	}
+
+	if state := b.State()[0]; !state.Changed.Switch.Equal(changed) {
+		t.Errorf("expected switch change time %s kept, got %s", changed, state.Changed.Switch)
+	}
+}
+
+func TestReconcilerReconnected(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	defer sim.Close()
+
+	host, port := testSimulatorAddr(t, sim)
+
+	// only reconnection triggers reconciliation
+	b := NewBridge(BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port, ReconcileInterval: 60000}, profile)
+	defer b.Close()
+
+	on := models.Light{}
+	on.SetZone(1)
+	on.SetSwitch(true)
+
+	err := b.ProcessSync(context.Background(), PriorityInteractive, on)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// broken connection is re-established by the next command, reconciliation must not undo it
+	b.connkeeper.Reset()
+
+	off := models.Light{}
+	off.SetZone(1)
+	off.SetSwitch(false)
+
+	err = b.ProcessSync(context.Background(), PriorityInteractive, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sim.Commands() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if sim.Commands() != 3 {
+		t.Errorf("expected %d commands, got %d", 3, sim.Commands())
+	}
+	if sim.Bulb(1).On {
+		t.Errorf("expected bulb switched off, got %+v", sim.Bulb(1))
+	}
+	if state := b.State()[0]; state.Switch == nil || *state.Switch != models.Off {
+		t.Errorf("expected switch %s, got %v", models.Off, state.Switch)
+	}
+}
+
+func TestBridgeSequenceZones(t *testing.T) {
+	on := models.On
+	seq := models.Sequence{
+		Name: "blink",
+		Steps: []models.SequenceStep{
+			{Light: models.Light{Zone: 2, Switch: &on}},
+			{Light: models.Light{Zone: 4, Switch: &on}},
+		},
+	}
+
+	b := Bridge{sequencer: &testSequencer{seq: &seq}}
+
+	zones := b.sequenceZones()
+	if len(zones) != 2 || !zones[2] || !zones[4] {
+		t.Errorf("expected zones 2 and 4, got %v", zones)
+	}
+
+	seq.Steps[1].Light.Zone = models.ZoneAll
+
+	zones = b.sequenceZones()
+	if len(zones) != models.MaxZone {
+		t.Errorf("expected all zones, got %v", zones)
+	}
+
+	b.sequencer = &testSequencer{}
+
+	zones = b.sequenceZones()
+	if len(zones) != 0 {
+		t.Errorf("expected no zones, got %v", zones)
+	}
+}
+
+type testSequencer struct {
+	seq    *models.Sequence
+	paused bool
+}
+
+func (s *testSequencer) Start(seq *models.Sequence) error {
+	s.seq = seq
+	return nil
+}
+
+func (s *testSequencer) StartAt(seq *models.Sequence, offset time.Duration) error {
+	return s.Start(seq)
+}
+
+func (s *testSequencer) Seek(step int) error {
+	return nil
+}
+
+func (s *testSequencer) Skip(steps int) error {
+	return nil
+}
+
+func (s *testSequencer) Stop() error {
+	s.seq = nil
+	return nil
+}
+
+func (s *testSequencer) Pause() error {
+	s.paused = s.seq != nil
+	return nil
+}
+
+func (s *testSequencer) Resume() error {
+	s.paused = false
+	return nil
+}
+
+func (s *testSequencer) Status() *models.Sequence {
+	return s.seq
+}
+
+func (s *testSequencer) Paused() bool {
+	return s.paused
+}
+
+func (s *testSequencer) Reason() string {
+	return ""
+}
+
+func (s *testSequencer) Progress() *models.SequenceProgress {
+	return nil
+}
+
+func (s *testSequencer) Snapshot() SequenceSnapshot {
+	return SequenceSnapshot{Sequence: s.seq, Paused: s.paused}
+}
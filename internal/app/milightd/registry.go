@@ -0,0 +1,103 @@
+package milightd
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnknownBridge is returned when command addresses not configured bridge.
+	ErrUnknownBridge = errors.New("unknown bridge")
+)
+
+// BridgeRegistry holds named Mi-Light bridges.
+type BridgeRegistry struct {
+	bridges map[string]*Bridge
+	names   []string
+}
+
+// NewBridgeRegistry returns registry with bridges created from configuration.
+// The first configured bridge is the default one.
+func NewBridgeRegistry(cfgs []BridgeConfig) (*BridgeRegistry, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("no bridges configured")
+	}
+	profiles := make([]*Profile, len(cfgs))
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("bridge #%d: missing name", i)
+		}
+		for _, other := range cfgs[:i] {
+			if other.Name == cfg.Name {
+				return nil, fmt.Errorf("bridge %s: duplicated name", cfg.Name)
+			}
+		}
+		if cfg.QueueSize < 0 || cfg.QueueTimeout < 0 {
+			return nil, fmt.Errorf("bridge %s: negative queue size or timeout", cfg.Name)
+		}
+		if cfg.RetryAttempts < 0 || cfg.RetryBackoff < 0 || cfg.RetryMaxBackoff < 0 || cfg.CommandDeadline < 0 {
+			return nil, fmt.Errorf("bridge %s: negative retry policy parameter", cfg.Name)
+		}
+		if cfg.BreakerThreshold < 0 || cfg.BreakerCooldown < 0 {
+			return nil, fmt.Errorf("bridge %s: negative circuit breaker parameter", cfg.Name)
+		}
+		if cfg.FadeRate < 0 {
+			return nil, fmt.Errorf("bridge %s: negative fade rate %d", cfg.Name, cfg.FadeRate)
+		}
+		if cfg.ReadyWindow < 0 {
+			return nil, fmt.Errorf("bridge %s: negative ready window %d", cfg.Name, cfg.ReadyWindow)
+		}
+		if cfg.ReconcileInterval < 0 {
+			return nil, fmt.Errorf("bridge %s: negative reconcile interval %d", cfg.Name, cfg.ReconcileInterval)
+		}
+		switch cfg.Restore {
+		case "", RestoreNone, RestoreLast:
+		case RestoreDefault:
+			if cfg.RestoreDefault == "" {
+				return nil, fmt.Errorf("bridge %s: missing default restored on startup", cfg.Name)
+			}
+		default:
+			return nil, fmt.Errorf("bridge %s: unknown restore policy %s", cfg.Name, cfg.Restore)
+		}
+		profile, err := NewProfile(cfg.Protocol, cfg.Bulb, cfg.Zones)
+		if err != nil {
+			return nil, fmt.Errorf("bridge %s: %s", cfg.Name, err)
+		}
+		profiles[i] = profile
+	}
+	r := BridgeRegistry{
+		bridges: make(map[string]*Bridge),
+	}
+	for i, cfg := range cfgs {
+		if cfg.Port == 0 {
+			cfg.Port = defaultPort(cfg.Protocol)
+		}
+		r.bridges[cfg.Name] = NewBridge(cfg, profiles[i])
+		r.names = append(r.names, cfg.Name)
+	}
+	return &r, nil
+}
+
+// Get returns bridge with the given name, empty name selects the default bridge.
+func (r *BridgeRegistry) Get(name string) (*Bridge, error) {
+	if name == "" {
+		name = r.names[0]
+	}
+	b, ok := r.bridges[name]
+	if !ok {
+		return nil, ErrUnknownBridge
+	}
+	return b, nil
+}
+
+// Names returns names of all bridges in configuration order.
+func (r *BridgeRegistry) Names() []string {
+	return r.names
+}
+
+// Close terminates all bridges.
+func (r *BridgeRegistry) Close() {
+	for _, name := range r.names {
+		r.bridges[name].Close()
+	}
+}
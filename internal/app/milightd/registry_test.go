@@ -0,0 +1,98 @@
+package milightd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBridgeRegistry(t *testing.T) {
+	cfgs := []BridgeConfig{
+		{Name: "kitchen", Host: "127.0.0.1", Port: DefaultBridgePort},
+		{Name: "hall", Host: "127.0.0.2", Port: DefaultBridgePort},
+	}
+
+	r, err := NewBridgeRegistry(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	expected := []string{"kitchen", "hall"}
+	if !reflect.DeepEqual(expected, r.Names()) {
+		t.Errorf("expected %v, got %v", expected, r.Names())
+	}
+
+	b, err := r.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != "kitchen" {
+		t.Errorf("expected default bridge %s, got %s", "kitchen", b.Name())
+	}
+
+	b, err = r.Get("hall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != "hall" {
+		t.Errorf("expected bridge %s, got %s", "hall", b.Name())
+	}
+
+	_, err = r.Get("garage")
+	if err != ErrUnknownBridge {
+		t.Errorf("expected %v, got %v", ErrUnknownBridge, err)
+	}
+}
+
+func TestBridgeRegistryInvalidConfig(t *testing.T) {
+	cases := [][]BridgeConfig{
+		nil,
+		{{Host: "127.0.0.1"}},
+		{{Name: "kitchen", Host: "127.0.0.1"}, {Name: "kitchen", Host: "127.0.0.2"}},
+		{{Name: "kitchen", Host: "127.0.0.1", Bulb: "rgb"}},
+		{{Name: "kitchen", Host: "127.0.0.1", Zones: map[int]string{5: BulbRGBW}}},
+		{{Name: "kitchen", Host: "127.0.0.1", Zones: map[int]string{1: "rgb"}}},
+		{{Name: "kitchen", Host: "127.0.0.1", Protocol: "v2"}},
+		{{Name: "kitchen", Host: "127.0.0.1", Protocol: ProtocolLegacy, Bulb: BulbBridgeLamp}},
+		{{Name: "kitchen", Host: "127.0.0.1", Protocol: ProtocolLegacy, Zones: map[int]string{3: BulbRGBWW}}},
+		{{Name: "kitchen", Host: "127.0.0.1", Restore: "always"}},
+		{{Name: "kitchen", Host: "127.0.0.1", ReconcileInterval: -1}},
+		{{Name: "kitchen", Host: "127.0.0.1", ReadyWindow: -1}},
+		{{Name: "kitchen", Host: "127.0.0.1", FadeRate: -1}},
+		{{Name: "kitchen", Host: "127.0.0.1", Restore: RestoreDefault}},
+	}
+	for _, tc := range cases {
+		_, err := NewBridgeRegistry(tc)
+		if err == nil {
+			t.Errorf("expected error for %v", tc)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, dirRemove := testTempDir(t)
+	defer dirRemove()
+
+	path := filepath.Join(dir, "milightd.json")
+	data := `{"bridges":[{"name":"kitchen","host":"192.168.0.102"},{"name":"hall","host":"192.168.0.103","port":5988,"bulb":"rgbw","zones":{"2":"cct"},"linkWindow":10000},{"name":"garage","host":"192.168.0.104","protocol":"legacy"}]}`
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BridgeConfig{
+		{Name: "kitchen", Host: "192.168.0.102", Port: DefaultBridgePort, LinkWindow: DefaultLinkWindow},
+		{Name: "hall", Host: "192.168.0.103", Port: 5988, Bulb: BulbRGBW, Zones: map[int]string{2: BulbCCT}, LinkWindow: 10000},
+		{Name: "garage", Host: "192.168.0.104", Port: DefaultLegacyBridgePort, Protocol: ProtocolLegacy, LinkWindow: DefaultLinkWindow},
+	}
+	if !reflect.DeepEqual(expected, cfg.Bridges) {
+		t.Errorf("expected %v, got %v", expected, cfg.Bridges)
+	}
+}
@@ -0,0 +1,81 @@
+package milightd
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+const (
+	// maxFailedCommands is the number of the latest failed commands kept for inspection.
+	maxFailedCommands = 100
+)
+
+var (
+	// errCommandExpired is returned when command isn't executed before its deadline.
+	errCommandExpired = errors.New("command deadline exceeded")
+)
+
+// retryPolicy represents retry policy of commands failed because of bridge connection problems.
+type retryPolicy struct {
+	// attempts is the maximal number of command execution attempts.
+	attempts int
+	// backoff is the delay before the first retry, doubled for every next one.
+	backoff time.Duration
+	// maxBackoff is the longest delay between retries.
+	maxBackoff time.Duration
+	// deadline is the longest time since command was queued until its execution.
+	deadline time.Duration
+}
+
+// delay returns delay before the next attempt after given number of failed attempts.
+// Delay is randomized between half and full backoff, so bridges recovering at the same time aren't flooded.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.backoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable checks whether command failed because of bridge connection problem.
+func retryable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errAllocateConnection) || errors.Is(err, milight.ErrInvalidResponse) || errors.As(err, &netErr)
+}
+
+// deadLetters keeps the latest commands which were never executed.
+type deadLetters struct {
+	commands []models.FailedCommand
+	mux      sync.Mutex
+}
+
+// add adds failed command, the oldest one is dropped when list is full.
+func (d *deadLetters) add(c models.FailedCommand) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if len(d.commands) >= maxFailedCommands {
+		d.commands = d.commands[1:]
+	}
+	d.commands = append(d.commands, c)
+}
+
+// list returns failed commands, from the oldest one.
+func (d *deadLetters) list() []models.FailedCommand {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	commands := make([]models.FailedCommand, len(d.commands))
+	copy(commands, d.commands)
+	return commands
+}
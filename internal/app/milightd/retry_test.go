@@ -0,0 +1,153 @@
+package milightd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/internal/pkg/simulator"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	cases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 10; i++ {
+			d := p.delay(tc.attempt)
+			if d < tc.max/2 || d > tc.max {
+				t.Errorf("attempt %d: expected delay between %s and %s, got %s", tc.attempt, tc.max/2, tc.max, d)
+			}
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{fmt.Errorf("%w: connection refused", errAllocateConnection), true},
+		{milight.ErrInvalidResponse, true},
+		{&net.OpError{Op: "read", Net: "udp", Err: testTimeoutError{}}, true},
+		{ErrInvalidColor, false},
+	}
+	for _, tc := range cases {
+		if retryable(tc.err) != tc.expected {
+			t.Errorf("%v: expected %v", tc.err, tc.expected)
+		}
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	var d deadLetters
+
+	for i := 0; i < maxFailedCommands+5; i++ {
+		d.add(models.FailedCommand{Command: strconv.Itoa(i)})
+	}
+
+	failed := d.list()
+
+	if len(failed) != maxFailedCommands {
+		t.Fatalf("expected %d failed commands, got %d", maxFailedCommands, len(failed))
+	}
+	if failed[0].Command != "5" {
+		t.Errorf("expected the oldest command %s, got %s", "5", failed[0].Command)
+	}
+}
+
+func TestBridgeRetry(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	// simulator isn't running at the first attempt
+	sim := testSimulator(t, profile)
+	addr := sim.Addr().String()
+	host, port := testSimulatorAddr(t, sim)
+	sim.Close()
+
+	cfg := BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port, RetryAttempts: 10, RetryBackoff: 100, RetryMaxBackoff: 100, BreakerThreshold: 10}
+
+	b := NewBridge(cfg, profile)
+	defer b.Close()
+
+	started := make(chan *simulator.Simulator, 1)
+
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		sim, err := simulator.Listen(addr, profile.Devices())
+		if err != nil {
+			log.Printf("can't start simulator: %s", err)
+		}
+		started <- sim
+	}()
+
+	l := models.Light{}
+	l.SetZone(1)
+	l.SetSwitch(true)
+
+	err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+
+	sim = <-started
+	if sim == nil {
+		t.Fatal("simulator not started")
+	}
+	defer sim.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sim.Bulb(1).On {
+		t.Errorf("expected bulb on, got %+v", sim.Bulb(1))
+	}
+	if failed := b.FailedCommands(); len(failed) != 0 {
+		t.Errorf("expected no failed commands, got %v", failed)
+	}
+}
+
+func TestBridgeFailedCommands(t *testing.T) {
+	profile := testProfile(t, BulbRGBW, nil)
+
+	sim := testSimulator(t, profile)
+	host, port := testSimulatorAddr(t, sim)
+	sim.Close()
+
+	cfg := BridgeConfig{Name: DefaultBridgeName, Host: host, Port: port, RetryAttempts: 2, RetryBackoff: 10}
+
+	b := NewBridge(cfg, profile)
+	defer b.Close()
+
+	l := models.Light{}
+	l.SetZone(2)
+	l.SetSwitch(true)
+
+	err := b.ProcessSync(context.Background(), PriorityInteractive, l)
+	if !errors.Is(err, ErrBridgeUnavailable) {
+		t.Errorf("expected %v, got %v", ErrBridgeUnavailable, err)
+	}
+
+	failed := b.FailedCommands()
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 failed command, got %v", failed)
+	}
+	if failed[0].Bridge != DefaultBridgeName || failed[0].Command != "zone 2 light switch on" || failed[0].Attempts != 2 {
+		t.Errorf("unexpected failed command %+v", failed[0])
+	}
+}
@@ -1,53 +1,271 @@
 package milightd
 
-import "github.com/sgrzywna/milightd/pkg/models"
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
 
 // Sequencer defines sequencer interface.
 type Sequencer interface {
 	// Start sequence.
 	Start(*models.Sequence) error
+	// StartAt starts sequence at the offset from its beginning.
+	StartAt(*models.Sequence, time.Duration) error
+	// Seek jumps to the step of the running sequence.
+	Seek(int) error
+	// Skip jumps forward or backward by the number of steps of the running sequence.
+	Skip(int) error
 	// Stop running sequence.
 	Stop() error
-	// Status returns status of the running sequence.
+	// Pause running sequence.
+	Pause() error
+	// Resume paused sequence.
+	Resume() error
+	// Status returns status of the running sequence, also the paused one.
 	Status() *models.Sequence
+	// Paused reports whether the sequence is paused.
+	Paused() bool
+	// Reason returns reason of the last sequence stop, it's set only for the completed sequence.
+	Reason() string
+	// Progress returns progress of the running sequence, also the paused one.
+	Progress() *models.SequenceProgress
+	// Snapshot returns sequence, its progress, pause and stop reason at once.
+	Snapshot() SequenceSnapshot
+}
+
+// SequenceSnapshot represents consistent state of the sequencer.
+// Sequence and progress are nil when no sequence is running, reason is set only for the completed sequence.
+type SequenceSnapshot struct {
+	Sequence *models.Sequence
+	Progress *models.SequenceProgress
+	Paused   bool
+	Reason   string
+}
+
+// SequenceHost represents bridge running sequences.
+type SequenceHost interface {
+	LightAPI
+	// State returns state of the light in zones paired with the bridge.
+	State() []models.LightState
+	// GetSequence returns sequence definition.
+	GetSequence(string) (*models.Sequence, error)
 }
 
 // SequenceProcessor implements light control sequencer.
+// End action of the completed sequence is executed by the processor, light state from before the sequence is kept for restore.
 type SequenceProcessor struct {
-	lightCtrl LightAPI
-	loop      *SequencerLoop
+	host         SequenceHost
+	fadeInterval time.Duration
+	loop         *SequencerLoop
+	paused       bool
+	reason       string
+	before       []models.LightState
+	mux          sync.Mutex
 }
 
-// NewSequenceProcessor returns initialized SequenceProcessor object.
-func NewSequenceProcessor(lightCtrl LightAPI) *SequenceProcessor {
+// NewSequenceProcessor returns initialized SequenceProcessor object, fade interval is the time between step transition commands.
+func NewSequenceProcessor(host SequenceHost, fadeInterval time.Duration) *SequenceProcessor {
 	return &SequenceProcessor{
-		lightCtrl: lightCtrl,
+		host:         host,
+		fadeInterval: fadeInterval,
 	}
 }
 
 // Start sequence.
 func (p *SequenceProcessor) Start(seq *models.Sequence) error {
+	return p.StartAt(seq, 0)
+}
+
+// StartAt starts sequence at the offset from its beginning.
+func (p *SequenceProcessor) StartAt(seq *models.Sequence, offset time.Duration) error {
+	if offset < 0 {
+		return fmt.Errorf("%w: negative offset %s", ErrInvalidValue, offset)
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
 	if p.loop != nil {
 		p.loop.Stop()
 		p.loop = nil
 	}
-	p.loop = NewSequencerLoop(p.lightCtrl, seq)
+	p.before = p.host.State()
+	p.start(seq, offset)
 	return nil
 }
 
+// start starts sequence loop.
+func (p *SequenceProcessor) start(seq *models.Sequence, offset time.Duration) {
+	p.loop = NewSequencerLoopAt(p.host, seq, offset, p.fadeInterval, func(l *SequencerLoop) {
+		// loop waits for stop, which needs processor lock
+		go p.complete(l)
+	})
+	p.paused = false
+	p.reason = ""
+}
+
 // Stop running sequence.
 func (p *SequenceProcessor) Stop() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
 	if p.loop != nil {
 		p.loop.Stop()
 		p.loop = nil
 	}
+	p.paused = false
+	p.reason = ""
+	return nil
+}
+
+// Pause running sequence, nothing is done when there is no sequence.
+func (p *SequenceProcessor) Pause() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.loop != nil {
+		p.loop.Pause()
+		p.paused = true
+	}
+	return nil
+}
+
+// Resume paused sequence, nothing is done when there is no sequence.
+func (p *SequenceProcessor) Resume() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.loop != nil {
+		p.loop.Resume()
+		p.paused = false
+	}
+	return nil
+}
+
+// Seek jumps to the step of the running sequence, nothing is done when there is no sequence.
+func (p *SequenceProcessor) Seek(step int) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.loop == nil {
+		return nil
+	}
+	if step < 0 || step >= len(p.loop.seq.Steps) {
+		return fmt.Errorf("%w: step %d out of range", ErrInvalidValue, step)
+	}
+	p.loop.Seek(step)
+	return nil
+}
+
+// Skip jumps forward or backward by the number of steps of the running sequence, nothing is done when there is no sequence.
+func (p *SequenceProcessor) Skip(steps int) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.loop != nil && steps != 0 {
+		p.loop.Skip(steps)
+	}
 	return nil
 }
 
 // Status returns status of the running sequence.
 func (p *SequenceProcessor) Status() *models.Sequence {
+	p.mux.Lock()
+	defer p.mux.Unlock()
 	if p.loop != nil {
 		return p.loop.seq
 	}
 	return nil
 }
+
+// Progress returns progress of the running sequence, also the paused one, it returns nil when there is no sequence.
+func (p *SequenceProcessor) Progress() *models.SequenceProgress {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.loop != nil {
+		return p.loop.Progress()
+	}
+	return nil
+}
+
+// Snapshot returns sequence, its progress, pause and stop reason at once.
+func (p *SequenceProcessor) Snapshot() SequenceSnapshot {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	s := SequenceSnapshot{
+		Paused: p.paused,
+		Reason: p.reason,
+	}
+	if p.loop != nil {
+		s.Sequence = p.loop.seq
+		s.Progress = p.loop.Progress()
+	}
+	return s
+}
+
+// Paused reports whether the sequence is paused.
+func (p *SequenceProcessor) Paused() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.paused
+}
+
+// Reason returns reason of the last sequence stop, it's set only for the completed sequence.
+func (p *SequenceProcessor) Reason() string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.reason
+}
+
+// complete stops completed sequence loop and executes sequence end action.
+// Nothing is done when the loop was stopped in the meantime.
+func (p *SequenceProcessor) complete(l *SequencerLoop) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.loop != l {
+		return
+	}
+	p.loop.Stop()
+	p.loop = nil
+	p.paused = false
+	p.reason = models.SeqCompleted
+
+	seq := l.seq
+	log.Printf("milightd sequence %s completed, end action %q", seq.Name, seq.End)
+
+	switch seq.End {
+	case models.SeqEndOff:
+		zones := sequenceZones(seq)
+		for zone := models.ZoneAll + 1; zone <= models.MaxZone; zone++ {
+			if !zones[zone] {
+				continue
+			}
+			off := models.Light{}
+			off.SetZone(zone)
+			off.SetSwitch(false)
+			p.process(off)
+		}
+	case models.SeqEndRestore:
+		for _, state := range p.before {
+			restored := lightFromState(state)
+			if restored.Switch == nil && restored.Color == nil && restored.Hue == nil && restored.Brightness == nil {
+				continue
+			}
+			p.process(restored)
+		}
+	case models.SeqEndChain:
+		next, err := p.host.GetSequence(seq.Next)
+		if err != nil {
+			log.Printf("milightd sequence %s can't chain %s: %s", seq.Name, seq.Next, err)
+			return
+		}
+		// chained sequence keeps the light state from before the first sequence for restore
+		p.start(next, 0)
+	}
+}
+
+// process sends end action light control command.
+func (p *SequenceProcessor) process(l models.Light) {
+	err := p.host.Process(context.Background(), PrioritySequence, l)
+	if err != nil {
+		log.Printf("milightd sequence end action %s failed: %s", l.String(), err)
+	}
+}
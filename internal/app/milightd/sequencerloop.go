@@ -1,58 +1,360 @@
 package milightd
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/sgrzywna/milightd/pkg/models"
 )
 
+// QueueAPI represents light controller reporting commands waiting for execution.
+type QueueAPI interface {
+	// Pending returns number of commands waiting for execution with the given priority and the limit of such commands.
+	Pending(Priority) (int, int)
+}
+
 // SequencerLoop represents sequencer loop.
+// Step transition fades zone hue and brightness with intermediate commands sent every fade interval.
+// Loop state is changed only by the loop goroutine, progress is recorded under the mutex for other readers.
 type SequencerLoop struct {
-	lightCtrl LightAPI
-	seq       *models.Sequence
-	stop      chan struct{}
-	step      int
+	lightCtrl    LightAPI
+	seq          *models.Sequence
+	fadeInterval time.Duration
+	completed    func(*SequencerLoop)
+	ctx          context.Context
+	cancel       context.CancelFunc
+	stop         chan struct{}
+	pause        chan bool
+	seek         chan seekRequest
+	step         int
+	playback     int
+	elapsed      time.Duration
+	levels       [models.MaxZone + 1]level
+	fade         *fade
+	rest         time.Duration
+	mux          sync.Mutex
+	progress     models.SequenceProgress
+	stepEnd      time.Time
+	pausedAt     time.Time
 }
 
-// NewSequencerLoop returns initialized SequencerLoop object.
-func NewSequencerLoop(lightCtrl LightAPI, seq *models.Sequence) *SequencerLoop {
+// seekRequest represents jump to the step, relative request moves by the number of steps from the current one.
+type seekRequest struct {
+	step     int
+	relative bool
+}
+
+// NewSequencerLoop returns initialized SequencerLoop object, zero fade interval disables step transitions.
+// Completed function is called from the loop when the last step of the finite sequence is over, loop waits for stop then.
+// It can be nil.
+func NewSequencerLoop(lightCtrl LightAPI, seq *models.Sequence, fadeInterval time.Duration, completed func(*SequencerLoop)) *SequencerLoop {
+	return NewSequencerLoopAt(lightCtrl, seq, 0, fadeInterval, completed)
+}
+
+// NewSequencerLoopAt returns initialized SequencerLoop object starting at the offset from the beginning of the sequence.
+// Offset longer than the sequence cycle starts the later playback.
+func NewSequencerLoopAt(lightCtrl LightAPI, seq *models.Sequence, offset time.Duration, fadeInterval time.Duration, completed func(*SequencerLoop)) *SequencerLoop {
+	ctx, cancel := context.WithCancel(context.Background())
 	loop := SequencerLoop{
-		lightCtrl: lightCtrl,
-		seq:       seq,
-		stop:      make(chan struct{}),
+		lightCtrl:    lightCtrl,
+		seq:          seq,
+		fadeInterval: fadeInterval,
+		completed:    completed,
+		ctx:          ctx,
+		cancel:       cancel,
+		stop:         make(chan struct{}),
+		pause:        make(chan bool),
+		seek:         make(chan seekRequest),
+	}
+	loop.step, loop.playback, loop.elapsed = position(seq, offset)
+	now := time.Now()
+	cycle := 0
+	for _, step := range seq.Steps {
+		cycle += step.Duration
 	}
+	loop.progress = models.SequenceProgress{
+		StepStarted:   now,
+		Step:          loop.step,
+		Iteration:     loop.playback + 1,
+		CycleDuration: cycle,
+		Started:       now,
+	}
+	loop.stepEnd = now
 	go loop.loop()
 	return &loop
 }
 
-// Stop terminates sequencer loop.
+// Stop terminates sequencer loop, step waiting for execution is abandoned.
 func (l *SequencerLoop) Stop() {
+	l.cancel()
 	l.stop <- struct{}{}
 	<-l.stop
 }
 
+// Pause freezes sequencer loop, the current step and the time left in it are kept.
+func (l *SequencerLoop) Pause() {
+	l.pause <- true
+}
+
+// Resume continues paused sequencer loop with the time left in the current step.
+func (l *SequencerLoop) Resume() {
+	l.pause <- false
+}
+
+// Seek jumps to the step, which is sent to the light controller immediately also when the loop is paused.
+func (l *SequencerLoop) Seek(step int) {
+	l.seek <- seekRequest{step: step}
+}
+
+// Skip jumps forward or backward by the number of steps.
+// Skip forward past the last step starts the next playback, skip backward wraps around within the current one.
+func (l *SequencerLoop) Skip(steps int) {
+	l.seek <- seekRequest{step: steps, relative: true}
+}
+
+// Progress returns progress of the sequence playback.
+func (l *SequencerLoop) Progress() *models.SequenceProgress {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	progress := l.progress
+	now := time.Now()
+	if !l.pausedAt.IsZero() {
+		now = l.pausedAt
+	}
+	if remaining := l.stepEnd.Sub(now); remaining > 0 {
+		progress.StepRemaining = int(remaining / time.Millisecond)
+	}
+	return &progress
+}
+
+// recordStep records start of the step, elapsed is the part of the step skipped by the start offset.
+func (l *SequencerLoop) recordStep(duration, elapsed time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	l.progress.Step = l.step
+	l.progress.StepStarted = now.Add(-elapsed)
+	l.progress.Iteration = l.playback + 1
+	l.stepEnd = now.Add(duration - elapsed)
+	if !l.pausedAt.IsZero() {
+		// step sent by seek while paused
+		l.pausedAt = now
+	}
+}
+
+// recordPause records pause of the step, step end is moved by the pause duration on resume.
+func (l *SequencerLoop) recordPause(paused bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if paused {
+		l.pausedAt = time.Now()
+		return
+	}
+	l.stepEnd = l.stepEnd.Add(time.Since(l.pausedAt))
+	l.pausedAt = time.Time{}
+}
+
 // loop is the sequencer main loop.
 func (l *SequencerLoop) loop() {
 	defer func() { l.stop <- struct{}{} }()
 
 	delay := time.Millisecond
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	next := time.Now().Add(delay)
+	paused := false
+	completed := false
 
 	for {
 		select {
 		case <-l.stop:
 			return
-		case <-time.After(delay):
-			delay = l.processStep()
+		case <-timer.C:
+			ok := true
+			if l.fade != nil {
+				delay = l.processFrame()
+			} else {
+				delay, ok = l.processStep()
+			}
+			if !ok {
+				completed = true
+				if l.completed != nil {
+					l.completed(l)
+				}
+				continue
+			}
+			next = time.Now().Add(delay)
+			timer.Reset(delay)
+		case pause := <-l.pause:
+			if pause == paused || completed {
+				continue
+			}
+			paused = pause
+			l.recordPause(paused)
+			if paused {
+				stopTimer(timer)
+				// time left in the current step
+				delay = time.Until(next)
+			} else {
+				next = time.Now().Add(delay)
+				timer.Reset(delay)
+			}
+		case s := <-l.seek:
+			if completed {
+				continue
+			}
+			if !paused {
+				stopTimer(timer)
+			}
+			l.fade = nil
+			l.step = l.target(s)
+			var ok bool
+			delay, ok = l.processStep()
+			if !ok {
+				completed = true
+				if l.completed != nil {
+					l.completed(l)
+				}
+				continue
+			}
+			if paused {
+				// paused loop keeps the whole step for resume
+				continue
+			}
+			next = time.Now().Add(delay)
+			timer.Reset(delay)
 		}
 	}
 }
 
-// processStep executes next step from sequence.
-func (l *SequencerLoop) processStep() time.Duration {
-	defer func() { l.step++ }()
+// stopTimer stops timer and drains its channel.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// target returns index of the step the seek request jumps to.
+func (l *SequencerLoop) target(s seekRequest) int {
+	n := len(l.seq.Steps)
+	if !s.relative || n == 0 {
+		return s.step
+	}
+	// progress is changed only by the loop goroutine
+	current := l.progress.Step + s.step
+	if s.step > 0 {
+		if current < n {
+			return current
+		}
+		// processStep wraps around into the next playback
+		return n
+	}
+	return (current%n + n) % n
+}
+
+// position returns step index, playback and time elapsed in the step at the offset from the beginning of the sequence.
+func position(seq *models.Sequence, offset time.Duration) (int, int, time.Duration) {
+	var cycle time.Duration
+	for _, step := range seq.Steps {
+		cycle += time.Duration(step.Duration) * time.Millisecond
+	}
+	if offset <= 0 || cycle <= 0 {
+		return 0, 0, 0
+	}
+	playback := int(offset / cycle)
+	offset %= cycle
+	for i, step := range seq.Steps {
+		duration := time.Duration(step.Duration) * time.Millisecond
+		if offset < duration {
+			return i, playback, offset
+		}
+		offset -= duration
+	}
+	return 0, playback, 0
+}
+
+// processStep executes next step from sequence, it returns false when the last playback of the finite sequence is over.
+func (l *SequencerLoop) processStep() (time.Duration, bool) {
 	if l.step >= len(l.seq.Steps) {
 		l.step = 0
+		l.playback++
+	}
+	if len(l.seq.Steps) == 0 || (l.seq.Repeat > 0 && l.playback >= l.seq.Repeat) {
+		return 0, false
+	}
+	defer func() { l.step++ }()
+
+	step := l.seq.Steps[l.step]
+	duration := time.Duration(step.Duration) * time.Millisecond
+	transition := time.Duration(step.Transition) * time.Millisecond
+	if transition > duration {
+		transition = duration
+	}
+
+	// step started at the offset is shorter, without transition
+	elapsed := l.elapsed
+	l.elapsed = 0
+
+	l.recordStep(duration, elapsed)
+
+	// invalid zone is reported by the light controller
+	if step.Light.Zone >= models.ZoneAll && step.Light.Zone <= models.MaxZone {
+		if elapsed == 0 {
+			l.fade = newFade(l.levels[step.Light.Zone], step.Light, l.fadeInterval, transition)
+		}
+		l.track(step.Light)
+	}
+
+	if l.fade == nil {
+		l.lightCtrl.Process(l.ctx, PrioritySequence, step.Light)
+		return duration - elapsed, true
+	}
+
+	if start, ok := l.fade.start(step.Light); ok {
+		l.lightCtrl.Process(l.ctx, PrioritySequence, start)
+	}
+	l.rest = duration - transition
+	return l.fadeInterval, true
+}
+
+// processFrame sends the next fade frame, intermediate frames are skipped while sequence commands pile up in the queue.
+// After the final frame it returns time left in the step.
+func (l *SequencerLoop) processFrame() time.Duration {
+	light, delay, final := l.fade.next()
+	if final {
+		l.fade = nil
+		l.lightCtrl.Process(l.ctx, PrioritySequence, light)
+		return l.rest
+	}
+	if !l.congested() {
+		l.lightCtrl.Process(l.ctx, PrioritySequence, light)
+	}
+	return delay
+}
+
+// congested reports whether more than half of the queue for sequence commands is taken.
+func (l *SequencerLoop) congested() bool {
+	q, ok := l.lightCtrl.(QueueAPI)
+	if !ok {
+		return false
+	}
+	pending, size := q.Pending(PrioritySequence)
+	return pending*2 > size
+}
+
+// track records zone hue and brightness set by the step.
+func (l *SequencerLoop) track(light models.Light) {
+	lv := lightLevel(light)
+	if light.Zone != models.ZoneAll {
+		l.levels[light.Zone] = l.levels[light.Zone].update(lv)
+		return
+	}
+	for zone := range l.levels {
+		l.levels[zone] = l.levels[zone].update(lv)
 	}
-	l.lightCtrl.Process(true, l.seq.Steps[l.step].Light)
-	return time.Duration(l.seq.Steps[l.step].Duration) * time.Millisecond
 }
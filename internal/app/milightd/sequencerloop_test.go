@@ -1,7 +1,11 @@
 package milightd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -9,12 +13,41 @@ import (
 )
 
 type LightAPIRecorder struct {
-	calls []models.Light
+	calls     []models.Light
+	states    []models.LightState
+	sequences map[string]*models.Sequence
+	mux       sync.Mutex
 }
 
-func (r *LightAPIRecorder) Process(fromSequence bool, l models.Light) bool {
+func (r *LightAPIRecorder) Process(ctx context.Context, p Priority, l models.Light) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
 	r.calls = append(r.calls, l)
-	return true
+	return nil
+}
+
+func (r *LightAPIRecorder) State() []models.LightState {
+	return r.states
+}
+
+func (r *LightAPIRecorder) GetSequence(name string) (*models.Sequence, error) {
+	seq, ok := r.sequences[name]
+	if !ok {
+		return nil, fmt.Errorf("sequence %s not found", name)
+	}
+	return seq, nil
+}
+
+func (r *LightAPIRecorder) last() models.Light {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.calls[len(r.calls)-1]
+}
+
+func (r *LightAPIRecorder) count() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.calls)
 }
 
 func TestSequencerLoop(t *testing.T) {
@@ -54,7 +87,7 @@ func TestSequencerLoop(t *testing.T) {
 
 	rec := LightAPIRecorder{}
 
-	loop := NewSequencerLoop(&rec, &seq)
+	loop := NewSequencerLoop(&rec, &seq, 0, nil)
 	time.Sleep(3 * time.Second)
 	loop.Stop()
 
@@ -70,3 +103,458 @@ func TestSequencerLoop(t *testing.T) {
 		t.Errorf("expected %v, got %v", seq.Steps[1].Light, rec.calls[1])
 	}
 }
+
+func TestSequencerLoopPause(t *testing.T) {
+	c0 := "yellow"
+	c1 := "green"
+
+	seq := models.Sequence{
+		Name: "first",
+		Steps: []models.SequenceStep{
+			{Light: models.Light{Color: &c0}, Duration: 1000},
+			{Light: models.Light{Color: &c1}, Duration: 1000},
+		},
+	}
+
+	rec := LightAPIRecorder{}
+
+	// steps are sent at 0s and 1s, pause leaves 0.5s of the second step
+	loop := NewSequencerLoop(&rec, &seq, 0, nil)
+	time.Sleep(1500 * time.Millisecond)
+	loop.Pause()
+
+	time.Sleep(1500 * time.Millisecond)
+
+	if rec.count() != 2 {
+		t.Fatalf("expected %d calls while paused, got %d", 2, rec.count())
+	}
+
+	loop.Resume()
+	time.Sleep(250 * time.Millisecond)
+
+	if rec.count() != 2 {
+		t.Fatalf("expected %d calls before the end of the step, got %d", 2, rec.count())
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	loop.Stop()
+
+	if len(rec.calls) != 3 {
+		t.Fatalf("expected %d calls after the end of the step, got %d", 3, len(rec.calls))
+	}
+
+	if !reflect.DeepEqual(seq.Steps[0].Light, rec.calls[2]) {
+		t.Errorf("expected %v, got %v", seq.Steps[0].Light, rec.calls[2])
+	}
+}
+
+func TestSequenceProcessorPause(t *testing.T) {
+	seq := models.Sequence{
+		Name:  "first",
+		Steps: []models.SequenceStep{{Light: models.Light{}, Duration: 1000}},
+	}
+
+	p := NewSequenceProcessor(&LightAPIRecorder{}, 0)
+
+	p.Pause()
+	if p.Paused() {
+		t.Errorf("expected sequence not paused without sequence")
+	}
+
+	p.Start(&seq)
+	p.Pause()
+	if !p.Paused() || p.Status() != &seq {
+		t.Errorf("expected paused sequence %s", seq.Name)
+	}
+
+	p.Resume()
+	if p.Paused() || p.Status() != &seq {
+		t.Errorf("expected running sequence %s", seq.Name)
+	}
+
+	p.Pause()
+	p.Stop()
+	if p.Paused() || p.Status() != nil {
+		t.Errorf("expected stopped sequence")
+	}
+}
+
+func TestSequenceProcessorSnapshot(t *testing.T) {
+	seq := models.Sequence{
+		Name:  "first",
+		Steps: []models.SequenceStep{{Light: models.Light{}, Duration: 1000}},
+	}
+
+	p := NewSequenceProcessor(&LightAPIRecorder{}, 0)
+
+	if s := p.Snapshot(); s.Sequence != nil || s.Progress != nil || s.Paused {
+		t.Errorf("expected empty snapshot without sequence, got %+v", s)
+	}
+
+	p.Start(&seq)
+	p.Pause()
+
+	s := p.Snapshot()
+	if s.Sequence != &seq || !s.Paused || s.Progress == nil || s.Progress.CycleDuration != 1000 {
+		t.Errorf("expected paused sequence %s with progress, got %+v", seq.Name, s)
+	}
+
+	p.Stop()
+
+	if s := p.Snapshot(); s.Sequence != nil || s.Progress != nil || s.Paused {
+		t.Errorf("expected empty snapshot after stop, got %+v", s)
+	}
+}
+
+func TestSequencerLoopRepeat(t *testing.T) {
+	c0 := "yellow"
+	c1 := "green"
+
+	seq := models.Sequence{
+		Name: "first",
+		Steps: []models.SequenceStep{
+			{Light: models.Light{Color: &c0}, Duration: 100},
+			{Light: models.Light{Color: &c1}, Duration: 100},
+		},
+		Repeat: 2,
+	}
+
+	rec := LightAPIRecorder{}
+
+	completed := make(chan *SequencerLoop, 1)
+
+	loop := NewSequencerLoop(&rec, &seq, 0, func(l *SequencerLoop) { completed <- l })
+	defer loop.Stop()
+
+	select {
+	case l := <-completed:
+		if l != loop {
+			t.Errorf("expected completed loop %p, got %p", loop, l)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("sequence not completed")
+	}
+
+	if rec.count() != 4 {
+		t.Errorf("expected %d calls, got %d", 4, rec.count())
+	}
+}
+
+func TestSequenceProcessorEnd(t *testing.T) {
+	off := models.Off
+	red := "red"
+	blue := "blue"
+	brightness := 20
+
+	step := models.SequenceStep{Light: models.Light{Zone: 2, Color: &blue}, Duration: 100}
+
+	cases := []struct {
+		seq  models.Sequence
+		last models.Light
+		name string
+	}{
+		{
+			seq:  models.Sequence{Name: "stop", Steps: []models.SequenceStep{step}, Repeat: 1, End: models.SeqEndStop},
+			last: step.Light,
+		},
+		{
+			seq:  models.Sequence{Name: "off", Steps: []models.SequenceStep{step}, Repeat: 1, End: models.SeqEndOff},
+			last: models.Light{Zone: 2, Switch: &off},
+		},
+		{
+			seq:  models.Sequence{Name: "restore", Steps: []models.SequenceStep{step}, Repeat: 1, End: models.SeqEndRestore},
+			last: models.Light{Zone: 2, Color: &red, Brightness: &brightness},
+		},
+		{
+			seq:  models.Sequence{Name: "chain", Steps: []models.SequenceStep{step}, Repeat: 1, End: models.SeqEndChain, Next: "next"},
+			last: models.Light{Zone: 3, Color: &red},
+			name: "next",
+		},
+	}
+	for _, tc := range cases {
+		rec := LightAPIRecorder{
+			states: []models.LightState{{Zone: 2, Color: &red, Brightness: &brightness}},
+			sequences: map[string]*models.Sequence{
+				"next": {Name: "next", Steps: []models.SequenceStep{{Light: models.Light{Zone: 3, Color: &red}, Duration: 1000}}},
+			},
+		}
+
+		p := NewSequenceProcessor(&rec, 0)
+		p.Start(&tc.seq)
+
+		// chained sequence runs instead of the completed one
+		completed := func() bool {
+			if tc.name != "" {
+				seq := p.Status()
+				return seq != nil && seq.Name == tc.name && rec.count() == 2
+			}
+			return p.Reason() == models.SeqCompleted
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for !completed() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if !completed() {
+			t.Fatalf("%s: sequence not completed", tc.seq.Name)
+		}
+
+		if tc.name == "" && p.Status() != nil {
+			t.Errorf("%s: expected stopped sequence, got %s", tc.seq.Name, p.Status().Name)
+		}
+
+		if !reflect.DeepEqual(tc.last, rec.last()) {
+			t.Errorf("%s: expected %v, got %v", tc.seq.Name, tc.last, rec.last())
+		}
+
+		p.Stop()
+	}
+}
+
+type congestedRecorder struct {
+	LightAPIRecorder
+}
+
+func (r *congestedRecorder) Pending(p Priority) (int, int) {
+	return 16, 16
+}
+
+func TestSequencerLoopFade(t *testing.T) {
+	h0, b0 := 0, 0
+	h1, b1 := 200, 64
+
+	seq := models.Sequence{
+		Name: "fade",
+		Steps: []models.SequenceStep{
+			{Light: models.Light{Zone: 1, Hue: &h0, Brightness: &b0}, Duration: 500},
+			{Light: models.Light{Zone: 1, Hue: &h1, Brightness: &b1}, Duration: 500, Transition: 400},
+		},
+		Repeat: 1,
+	}
+
+	final := models.Light{Zone: 1, Hue: &h1, Brightness: &b1}
+
+	rec := LightAPIRecorder{}
+
+	completed := make(chan *SequencerLoop, 1)
+
+	loop := NewSequencerLoop(&rec, &seq, 50*time.Millisecond, func(l *SequencerLoop) { completed <- l })
+	defer loop.Stop()
+
+	select {
+	case <-completed:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("sequence not completed")
+	}
+
+	// first step, 7 intermediate frames and the final one
+	if len(rec.calls) != 9 {
+		t.Fatalf("expected %d calls, got %d", 9, len(rec.calls))
+	}
+
+	for i := 2; i < len(rec.calls); i++ {
+		if *rec.calls[i].Brightness <= *rec.calls[i-1].Brightness {
+			t.Errorf("expected brightness increasing, got %d after %d", *rec.calls[i].Brightness, *rec.calls[i-1].Brightness)
+		}
+		// shortest path from 0 to 200 goes down through 255
+		if hue := *rec.calls[i].Hue; hue != 0 && hue < 200 {
+			t.Errorf("expected hue on the shortest path, got %d", hue)
+		}
+	}
+
+	if !reflect.DeepEqual(final, rec.last()) {
+		t.Errorf("expected %v, got %v", final, rec.last())
+	}
+
+	congested := congestedRecorder{}
+
+	loop = NewSequencerLoop(&congested, &seq, 50*time.Millisecond, func(l *SequencerLoop) { completed <- l })
+	defer loop.Stop()
+
+	select {
+	case <-completed:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("sequence not completed")
+	}
+
+	// intermediate frames are skipped
+	if len(congested.calls) != 2 {
+		t.Fatalf("expected %d calls, got %d", 2, len(congested.calls))
+	}
+
+	if !reflect.DeepEqual(final, congested.last()) {
+		t.Errorf("expected %v, got %v", final, congested.last())
+	}
+}
+
+func TestSequencerLoopProgress(t *testing.T) {
+	seq := models.Sequence{
+		Name: "progress",
+		Steps: []models.SequenceStep{
+			{Light: models.Light{}, Duration: 500},
+			{Light: models.Light{}, Duration: 1000},
+		},
+	}
+
+	rec := LightAPIRecorder{}
+
+	// steps are sent at 0s and 0.5s, the second step ends at 1.5s
+	loop := NewSequencerLoop(&rec, &seq, 0, nil)
+	defer loop.Stop()
+
+	time.Sleep(700 * time.Millisecond)
+
+	progress := loop.Progress()
+	if progress.Step != 1 || progress.Iteration != 1 || progress.CycleDuration != 1500 {
+		t.Errorf("expected step %d of iteration %d, cycle %d, got %+v", 1, 1, 1500, progress)
+	}
+	if progress.StepRemaining < 600 || progress.StepRemaining > 1000 {
+		t.Errorf("expected about %d ms remaining, got %d", 800, progress.StepRemaining)
+	}
+
+	loop.Pause()
+	remaining := loop.Progress().StepRemaining
+	time.Sleep(300 * time.Millisecond)
+
+	if loop.Progress().StepRemaining != remaining {
+		t.Errorf("expected %d ms remaining while paused, got %d", remaining, loop.Progress().StepRemaining)
+	}
+
+	// pause moves the end of the second step to 1.8s
+	loop.Resume()
+	time.Sleep(900 * time.Millisecond)
+
+	progress = loop.Progress()
+	if progress.Step != 0 || progress.Iteration != 2 {
+		t.Errorf("expected step %d of iteration %d, got %+v", 0, 2, progress)
+	}
+	if progress.StepStarted.Before(progress.Started) {
+		t.Errorf("expected step started after sequence start, got %+v", progress)
+	}
+}
+
+func TestSequencerLoopSeek(t *testing.T) {
+	c0 := "yellow"
+	c1 := "green"
+	c2 := "blue"
+
+	seq := models.Sequence{
+		Name: "seek",
+		Steps: []models.SequenceStep{
+			{Light: models.Light{Color: &c0}, Duration: 1000},
+			{Light: models.Light{Color: &c1}, Duration: 1000},
+			{Light: models.Light{Color: &c2}, Duration: 1000},
+		},
+	}
+
+	rec := LightAPIRecorder{}
+
+	// offset starts in the middle of the second step of the second playback
+	loop := NewSequencerLoopAt(&rec, &seq, 4500*time.Millisecond, 0, nil)
+	defer loop.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	progress := loop.Progress()
+	if progress.Step != 1 || progress.Iteration != 2 || progress.StepRemaining > 500 {
+		t.Errorf("expected step %d of iteration %d with less than %d ms remaining, got %+v", 1, 2, 500, progress)
+	}
+
+	var testCases = []struct {
+		name     string
+		action   func()
+		expected int
+	}{
+		{"seek", func() { loop.Seek(0) }, 0},
+		{"next", func() { loop.Skip(1) }, 1},
+		{"previous", func() { loop.Skip(-1) }, 0},
+		{"previous wraps around", func() { loop.Skip(-1) }, 2},
+		{"paused seek", func() { loop.Pause(); loop.Seek(1) }, 1},
+	}
+
+	for _, tc := range testCases {
+		count := rec.count()
+		tc.action()
+		time.Sleep(50 * time.Millisecond)
+		if rec.count() != count+1 {
+			t.Fatalf("%s: expected %d calls, got %d", tc.name, count+1, rec.count())
+		}
+		if !reflect.DeepEqual(seq.Steps[tc.expected].Light, rec.last()) {
+			t.Errorf("%s: expected %v, got %v", tc.name, seq.Steps[tc.expected].Light, rec.last())
+		}
+		if loop.Progress().Step != tc.expected {
+			t.Errorf("%s: expected step %d, got %d", tc.name, tc.expected, loop.Progress().Step)
+		}
+	}
+
+	// paused loop stays at the step it jumped to
+	count := rec.count()
+	time.Sleep(1200 * time.Millisecond)
+	if rec.count() != count {
+		t.Errorf("expected %d calls while paused, got %d", count, rec.count())
+	}
+
+	// next past the last step starts the next playback
+	loop.Seek(2)
+	loop.Skip(1)
+	progress = loop.Progress()
+	if progress.Step != 0 || progress.Iteration != 3 {
+		t.Errorf("expected step %d of iteration %d, got %+v", 0, 3, progress)
+	}
+}
+
+func TestSequencePosition(t *testing.T) {
+	seq := models.Sequence{
+		Steps: []models.SequenceStep{
+			{Duration: 1000},
+			{Duration: 500},
+		},
+	}
+
+	var testCases = []struct {
+		offset   time.Duration
+		step     int
+		playback int
+		elapsed  time.Duration
+	}{
+		{0, 0, 0, 0},
+		{400 * time.Millisecond, 0, 0, 400 * time.Millisecond},
+		{1000 * time.Millisecond, 1, 0, 0},
+		{1200 * time.Millisecond, 1, 0, 200 * time.Millisecond},
+		{3100 * time.Millisecond, 0, 2, 100 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		step, playback, elapsed := position(&seq, tc.offset)
+		if step != tc.step || playback != tc.playback || elapsed != tc.elapsed {
+			t.Errorf("offset %s: expected %d, %d, %s, got %d, %d, %s", tc.offset, tc.step, tc.playback, tc.elapsed, step, playback, elapsed)
+		}
+	}
+}
+
+func TestSequenceProcessorSeek(t *testing.T) {
+	seq := models.Sequence{
+		Name:  "first",
+		Steps: []models.SequenceStep{{Light: models.Light{}, Duration: 1000}},
+	}
+
+	p := NewSequenceProcessor(&LightAPIRecorder{}, 0)
+
+	if err := p.Seek(5); err != nil {
+		t.Errorf("expected no error without sequence, got %s", err)
+	}
+
+	if err := p.StartAt(&seq, -time.Second); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected %s, got %v", ErrInvalidValue, err)
+	}
+
+	p.Start(&seq)
+	defer p.Stop()
+
+	if err := p.Seek(1); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected %s, got %v", ErrInvalidValue, err)
+	}
+	if err := p.Seek(0); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+}
@@ -2,9 +2,12 @@ package milightd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/pprof"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/handlers"
@@ -12,6 +15,11 @@ import (
 	"github.com/sgrzywna/milightd/pkg/models"
 )
 
+const (
+	// retryAfter is the delay in seconds suggested to clients of the busy bridge.
+	retryAfter = 1
+)
+
 // Server represents milightd HTTP server.
 type Server struct {
 	srv *http.Server
@@ -45,10 +53,40 @@ func newRouter(m Controller, enableProfiling bool) *mux.Router {
 	r := mux.NewRouter()
 	v1 := r.PathPrefix("/api/v1/").Subrouter()
 
+	r.HandleFunc("/healthz", healthzHandler).Methods("GET")
+
+	r.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readyzHandler(w, r, m)
+	}).Methods("GET")
+
 	v1.HandleFunc("/light", func(w http.ResponseWriter, r *http.Request) {
 		lightHandler(w, r, m)
 	}).Methods("POST")
 
+	v1.HandleFunc("/light", func(w http.ResponseWriter, r *http.Request) {
+		getLight(w, r, m)
+	}).Methods("GET", "OPTIONS")
+
+	v1.HandleFunc("/zones/{zone:[0-9]+}/link", func(w http.ResponseWriter, r *http.Request) {
+		linkHandler(w, r, m, false)
+	}).Methods("POST")
+
+	v1.HandleFunc("/zones/{zone:[0-9]+}/unlink", func(w http.ResponseWriter, r *http.Request) {
+		linkHandler(w, r, m, true)
+	}).Methods("POST")
+
+	v1.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
+		listDevices(w, r, m)
+	}).Methods("GET", "OPTIONS")
+
+	v1.HandleFunc("/diagnostics/bridges", func(w http.ResponseWriter, r *http.Request) {
+		listBridges(w, r, m)
+	}).Methods("GET", "OPTIONS")
+
+	v1.HandleFunc("/diagnostics/failed-commands", func(w http.ResponseWriter, r *http.Request) {
+		listFailedCommands(w, r, m)
+	}).Methods("GET", "OPTIONS")
+
 	v1.HandleFunc("/sequence", func(w http.ResponseWriter, r *http.Request) {
 		listSequences(w, r, m)
 	}).Methods("GET", "OPTIONS")
@@ -90,6 +128,26 @@ func newRouter(m Controller, enableProfiling bool) *mux.Router {
 func lightHandler(w http.ResponseWriter, r *http.Request, c Controller) {
 	var l models.Light
 
+	sync := false
+	if v := r.URL.Query().Get("sync"); v != "" {
+		var err error
+		sync, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	priority := PriorityInteractive
+	switch r.URL.Query().Get("priority") {
+	case "", models.PriorityInteractive:
+	case models.PriorityAlert:
+		priority = PriorityAlert
+	default:
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
 	err := json.NewDecoder(r.Body).Decode(&l)
 	if err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest)
@@ -97,10 +155,188 @@ func lightHandler(w http.ResponseWriter, r *http.Request, c Controller) {
 	}
 	defer r.Body.Close()
 
-	if !c.Process(false, l) {
+	if sync {
+		err = c.ProcessSync(r.Context(), priority, l)
+	} else {
+		err = c.Process(r.Context(), priority, l)
+	}
+	if err != nil {
+		lightError(w, err)
+		return
+	}
+}
+
+func getLight(w http.ResponseWriter, r *http.Request, c Controller) {
+	states, err := c.GetLight(r.URL.Query().Get("bridge"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownBridge) {
+			http.Error(w, "bridge not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(states)
+	if err != nil {
 		http.Error(w, "milightd error", http.StatusInternalServerError)
+	}
+}
+
+func linkHandler(w http.ResponseWriter, r *http.Request, c Controller, unlink bool) {
+	vars := mux.Vars(r)
+
+	zone, err := strconv.Atoi(vars["zone"])
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var l models.Link
+
+	// request body is optional, defaults are used without it
+	err = json.NewDecoder(r.Body).Decode(&l)
+	if err != nil && err != io.EOF {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if unlink {
+		err = c.Unlink(zone, l)
+	} else {
+		err = c.Link(zone, l)
+	}
+	if err != nil {
+		lightError(w, err)
 		return
 	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// lightError translates light control error into HTTP response.
+func lightError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidZone), errors.Is(err, ErrInvalidColor), errors.Is(err, ErrInvalidValue):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrUnsupportedFeature):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrUnknownBridge):
+		http.Error(w, "bridge not found", http.StatusNotFound)
+	case errors.Is(err, ErrBridgeUnavailable):
+		errorResponse(w, http.StatusBadGateway, models.ErrorBridgeUnavailable, err)
+	case errors.Is(err, ErrBridgeTimeout):
+		errorResponse(w, http.StatusGatewayTimeout, models.ErrorBridgeTimeout, err)
+	case errors.Is(err, ErrBridgeBusy):
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		errorResponse(w, http.StatusServiceUnavailable, models.ErrorBridgeBusy, err)
+	default:
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+	}
+}
+
+// errorResponse writes structured error response.
+func errorResponse(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.Error{Code: code, Message: err.Error()})
+}
+
+// healthzHandler reports running process.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.Health{Status: models.HealthOK})
+}
+
+// readyzHandler reports result of the readiness checks, with service unavailable status when any check fails.
+func readyzHandler(w http.ResponseWriter, r *http.Request, c Controller) {
+	health := c.Ready()
+
+	status := http.StatusOK
+	if health.Status != models.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(health)
+	if err != nil {
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+	}
+}
+
+func listBridges(w http.ResponseWriter, r *http.Request, c Controller) {
+	statuses, err := c.GetBridges()
+	if err != nil {
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(statuses)
+	if err != nil {
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+	}
+}
+
+func listFailedCommands(w http.ResponseWriter, r *http.Request, c Controller) {
+	commands, err := c.GetFailedCommands(r.URL.Query().Get("bridge"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownBridge) {
+			http.Error(w, "bridge not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(commands)
+	if err != nil {
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+	}
+}
+
+func listDevices(w http.ResponseWriter, r *http.Request, c Controller) {
+	devices, err := c.GetDevices()
+	if err != nil {
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(devices)
+	if err != nil {
+		http.Error(w, "milightd error", http.StatusInternalServerError)
+	}
 }
 
 func listSequences(w http.ResponseWriter, r *http.Request, c Controller) {
@@ -135,6 +371,10 @@ func addSequence(w http.ResponseWriter, r *http.Request, c Controller) {
 
 	err = c.AddSequence(seq)
 	if err != nil {
+		if errors.Is(err, ErrInvalidValue) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "milightd error", http.StatusInternalServerError)
 		return
 	}
@@ -191,9 +431,14 @@ func deleteSequence(w http.ResponseWriter, r *http.Request, c Controller) {
 }
 
 func getSequenceState(w http.ResponseWriter, r *http.Request, c Controller) {
-	state, err := c.GetSequenceState()
+	state, err := c.GetSequenceState(r.URL.Query().Get("bridge"))
 	if err != nil {
+		if err == ErrUnknownBridge {
+			http.Error(w, "bridge not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "milightd error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -221,7 +466,16 @@ func setSequenceState(w http.ResponseWriter, r *http.Request, c Controller) {
 
 	newState, err := c.SetSequenceState(state)
 	if err != nil {
+		if err == ErrUnknownBridge {
+			http.Error(w, "bridge not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrInvalidValue) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "milightd error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
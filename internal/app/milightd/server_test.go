@@ -1,6 +1,7 @@
 package milightd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,20 +9,95 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sgrzywna/milightd/pkg/models"
 )
 
+const testUnknownBridge = "unknown"
+
 type TestController struct {
 	l         models.Light
+	devices   []models.Device
 	sequences []models.Sequence
 	name      string
+	bridge    string
 	state     models.SequenceState
+	zone      int
+	link      *models.Link
+	unlink    bool
+	sync      bool
+	syncErr   error
+	states    []models.LightState
+	priority  Priority
+	failed    []models.FailedCommand
+	statuses  []models.BridgeStatus
+	health    models.Health
 }
 
-func (m *TestController) Process(fromSequence bool, l models.Light) bool {
+func (m *TestController) Process(ctx context.Context, p Priority, l models.Light) error {
+	if l.Bridge == testUnknownBridge {
+		return ErrUnknownBridge
+	}
+	if l.Zone < models.ZoneAll || l.Zone > models.MaxZone {
+		return ErrInvalidZone
+	}
 	m.l = l
-	return true
+	m.priority = p
+	return nil
+}
+
+func (m *TestController) ProcessSync(ctx context.Context, p Priority, l models.Light) error {
+	err := m.Process(ctx, p, l)
+	if err != nil {
+		return err
+	}
+	m.sync = true
+	return m.syncErr
+}
+
+func (m *TestController) GetLight(bridge string) ([]models.LightState, error) {
+	if bridge == testUnknownBridge {
+		return nil, ErrUnknownBridge
+	}
+	m.bridge = bridge
+	return m.states, nil
+}
+
+func (m *TestController) GetBridges() ([]models.BridgeStatus, error) {
+	return m.statuses, nil
+}
+
+func (m *TestController) GetFailedCommands(bridge string) ([]models.FailedCommand, error) {
+	if bridge == testUnknownBridge {
+		return nil, ErrUnknownBridge
+	}
+	m.bridge = bridge
+	return m.failed, nil
+}
+
+func (m *TestController) Ready() models.Health {
+	return m.health
+}
+
+func (m *TestController) Link(zone int, l models.Link) error {
+	if zone <= models.ZoneAll || zone > models.MaxZone {
+		return ErrInvalidZone
+	}
+	m.zone = zone
+	m.link = &l
+	m.unlink = false
+	return nil
+}
+
+func (m *TestController) Unlink(zone int, l models.Link) error {
+	err := m.Link(zone, l)
+	m.unlink = true
+	return err
+}
+
+func (m *TestController) GetDevices() ([]models.Device, error) {
+	return m.devices, nil
 }
 
 func (m *TestController) GetSequences() ([]models.Sequence, error) {
@@ -34,6 +110,10 @@ func (m *TestController) GetSequence(name string) (*models.Sequence, error) {
 }
 
 func (m *TestController) AddSequence(seq models.Sequence) error {
+	err := validateSequence(seq)
+	if err != nil {
+		return err
+	}
 	m.sequences = append(m.sequences, seq)
 	return nil
 }
@@ -43,21 +123,31 @@ func (m *TestController) DeleteSequence(name string) error {
 	return nil
 }
 
-func (m *TestController) GetSequenceState() (*models.SequenceState, error) {
+func (m *TestController) GetSequenceState(bridge string) (*models.SequenceState, error) {
+	if bridge == testUnknownBridge {
+		return nil, ErrUnknownBridge
+	}
+	m.bridge = bridge
 	return &m.state, nil
 }
 
 func (m *TestController) SetSequenceState(state models.SequenceState) (*models.SequenceState, error) {
+	switch state.Action {
+	case "", models.SeqSeek, models.SeqNext, models.SeqPrevious:
+	default:
+		return nil, fmt.Errorf("%w: unknown sequence action %s", ErrInvalidValue, state.Action)
+	}
 	m.state = state
 	return &m.state, nil
 }
 
 func TestLightHandler(t *testing.T) {
+	zone := 2
 	color := "red"
 	brightness := 16
 	on := "on"
 
-	data := fmt.Sprintf("{\"color\":\"%s\",\"brightness\":%d,\"switch\":\"%s\"}", color, brightness, on)
+	data := fmt.Sprintf("{\"zone\":%d,\"color\":\"%s\",\"brightness\":%d,\"switch\":\"%s\"}", zone, color, brightness, on)
 
 	req, err := http.NewRequest("POST", "/api/v1/light", strings.NewReader(data))
 	if err != nil {
@@ -74,6 +164,10 @@ func TestLightHandler(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
 	}
 
+	if c.l.Zone != zone {
+		t.Errorf("wrong zone: got %d want %d", c.l.Zone, zone)
+	}
+
 	if c.l.Color == nil {
 		t.Error("wrong color: got nil")
 	} else if *c.l.Color != color {
@@ -93,6 +187,259 @@ func TestLightHandler(t *testing.T) {
 	}
 }
 
+func TestLightHandlerSync(t *testing.T) {
+	cases := []struct {
+		query    string
+		syncErr  error
+		sync     bool
+		expected int
+		code     string
+	}{
+		{"", nil, false, http.StatusOK, ""},
+		{"?sync=true", nil, true, http.StatusOK, ""},
+		{"?sync=1", fmt.Errorf("%w: no response", ErrBridgeTimeout), true, http.StatusGatewayTimeout, models.ErrorBridgeTimeout},
+		{"?sync=true", fmt.Errorf("%w: invalid response", ErrBridgeUnavailable), true, http.StatusBadGateway, models.ErrorBridgeUnavailable},
+		{"?sync=true", fmt.Errorf("%w: context deadline exceeded", ErrBridgeBusy), true, http.StatusServiceUnavailable, models.ErrorBridgeBusy},
+		{"?sync=maybe", nil, false, http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		req, err := http.NewRequest("POST", "/api/v1/light"+tc.query, strings.NewReader("{\"switch\":\"on\"}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := TestController{syncErr: tc.syncErr}
+
+		rr := httptest.NewRecorder()
+
+		newRouter(&c, false).ServeHTTP(rr, req)
+
+		if rr.Code != tc.expected {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tc.query, rr.Code, tc.expected)
+		}
+
+		if c.sync != tc.sync {
+			t.Errorf("%s: expected sync %v, got %v", tc.query, tc.sync, c.sync)
+		}
+
+		if tc.expected == http.StatusServiceUnavailable && rr.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected Retry-After header", tc.query)
+		}
+
+		if tc.code == "" {
+			continue
+		}
+
+		var e models.Error
+
+		err = json.NewDecoder(rr.Body).Decode(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Code != tc.code || e.Message != tc.syncErr.Error() {
+			t.Errorf("%s: expected %s %s, got %s %s", tc.query, tc.code, tc.syncErr, e.Code, e.Message)
+		}
+	}
+}
+
+func TestLightHandlerPriority(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected int
+		priority Priority
+	}{
+		{"", http.StatusOK, PriorityInteractive},
+		{"?priority=interactive", http.StatusOK, PriorityInteractive},
+		{"?priority=alert", http.StatusOK, PriorityAlert},
+		{"?priority=alert&sync=true", http.StatusOK, PriorityAlert},
+		{"?priority=sequence", http.StatusBadRequest, PriorityAlert},
+	}
+	for _, tc := range cases {
+		req, err := http.NewRequest("POST", "/api/v1/light"+tc.query, strings.NewReader("{\"switch\":\"on\"}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := TestController{}
+
+		rr := httptest.NewRecorder()
+
+		newRouter(&c, false).ServeHTTP(rr, req)
+
+		if rr.Code != tc.expected {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tc.query, rr.Code, tc.expected)
+		}
+
+		if tc.expected == http.StatusOK && c.priority != tc.priority {
+			t.Errorf("%s: expected priority %d, got %d", tc.query, tc.priority, c.priority)
+		}
+	}
+}
+
+func TestLightHandlerInvalidZone(t *testing.T) {
+	req, err := http.NewRequest("POST", "/api/v1/light", strings.NewReader("{\"zone\":5,\"switch\":\"on\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := TestController{}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLightHandlerUnknownBridge(t *testing.T) {
+	data := fmt.Sprintf("{\"bridge\":\"%s\",\"switch\":\"on\"}", testUnknownBridge)
+
+	req, err := http.NewRequest("POST", "/api/v1/light", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := TestController{}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetLight(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/light?bridge=hall", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	on := models.On
+	brightness := 16
+
+	c := TestController{}
+	c.states = []models.LightState{
+		{Bridge: "hall", Zone: 1, Switch: &on, Brightness: &brightness, LastSend: &models.SendStatus{Success: true}},
+	}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if c.bridge != "hall" {
+		t.Errorf("expected %s, got %s", "hall", c.bridge)
+	}
+
+	var states []models.LightState
+
+	err = json.NewDecoder(rr.Body).Decode(&states)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.states, states) {
+		t.Errorf("expected %v, got %v", c.states, states)
+	}
+
+	req, err = http.NewRequest("GET", "/api/v1/light?bridge="+testUnknownBridge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestLinkHandler(t *testing.T) {
+	cases := []struct {
+		path     string
+		data     string
+		zone     int
+		link     models.Link
+		unlink   bool
+		expected int
+	}{
+		{"/api/v1/zones/2/link", `{"bridge":"hall","duration":3000}`, 2, models.Link{Bridge: "hall", Duration: 3000}, false, http.StatusAccepted},
+		{"/api/v1/zones/3/unlink", "", 3, models.Link{}, true, http.StatusAccepted},
+		{"/api/v1/zones/0/link", "", 0, models.Link{}, false, http.StatusBadRequest},
+		{"/api/v1/zones/1/link", "{", 0, models.Link{}, false, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req, err := http.NewRequest("POST", tc.path, strings.NewReader(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := TestController{}
+
+		rr := httptest.NewRecorder()
+
+		newRouter(&c, false).ServeHTTP(rr, req)
+
+		if rr.Code != tc.expected {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tc.path, rr.Code, tc.expected)
+		}
+
+		if tc.expected != http.StatusAccepted {
+			continue
+		}
+
+		if c.zone != tc.zone || c.unlink != tc.unlink || c.link == nil || *c.link != tc.link {
+			t.Errorf("%s: expected zone %d unlink %v %v, got zone %d unlink %v %v", tc.path, tc.zone, tc.unlink, tc.link, c.zone, c.unlink, c.link)
+		}
+	}
+}
+
+func TestGetDevices(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/devices", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := TestController{}
+	c.devices = []models.Device{
+		{
+			Bridge:       DefaultBridgeName,
+			Zone:         1,
+			Bulb:         BulbRGBWW,
+			Capabilities: bulbTypes[BulbRGBWW].capabilities,
+		},
+	}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var devices []models.Device
+
+	err = json.NewDecoder(rr.Body).Decode(&devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.devices, devices) {
+		t.Errorf("expected %v, got %v", c.devices, devices)
+	}
+}
+
 func TestGetSequences(t *testing.T) {
 	req, err := http.NewRequest("GET", "/api/v1/sequence", nil)
 	if err != nil {
@@ -181,6 +528,36 @@ func TestAddSequence(t *testing.T) {
 	}
 }
 
+func TestAddSequenceInvalid(t *testing.T) {
+	cases := []models.Sequence{
+		{Name: "first", Repeat: -1},
+		{Name: "first", End: "fade"},
+		{Name: "first", End: models.SeqEndChain},
+		{Name: "first", Steps: []models.SequenceStep{{Duration: 1000, Transition: -1}}},
+	}
+	for _, seq := range cases {
+		data, err := json.Marshal(seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/api/v1/sequence", strings.NewReader(string(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := TestController{}
+
+		rr := httptest.NewRecorder()
+
+		newRouter(&c, false).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%+v: handler returned wrong status code: got %v want %v", seq, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
 func TestDeleteSequence(t *testing.T) {
 	req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/v1/sequence/%s", tests[0].Name), nil)
 	if err != nil {
@@ -229,6 +606,84 @@ func TestGetSequenceState(t *testing.T) {
 	}
 }
 
+func TestGetSequenceProgress(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/seqctrl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Date(2021, 3, 14, 18, 1, 2, 0, time.UTC)
+
+	c := TestController{}
+	c.state = models.SequenceState{
+		Name:  tests[0].Name,
+		State: models.SeqPaused,
+		Progress: &models.SequenceProgress{
+			Step:          1,
+			StepStarted:   started.Add(90 * time.Second),
+			StepRemaining: 25000,
+			Iteration:     2,
+			CycleDuration: 60000,
+			Started:       started,
+		},
+	}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var state models.SequenceState
+
+	err = json.NewDecoder(rr.Body).Decode(&state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.state, state) {
+		t.Errorf("expected %+v, got %+v", c.state, state)
+	}
+}
+
+func TestGetBridgeSequenceState(t *testing.T) {
+	bridge := "kitchen"
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("/api/v1/seqctrl?bridge=%s", bridge), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := TestController{}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if c.bridge != bridge {
+		t.Errorf("expected %s, got %s", bridge, c.bridge)
+	}
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("/api/v1/seqctrl?bridge=%s", testUnknownBridge), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
 func TestSetSequenceState(t *testing.T) {
 	testState := models.SequenceState{
 		Name:  tests[0].Name,
@@ -259,3 +714,197 @@ func TestSetSequenceState(t *testing.T) {
 		t.Errorf("expected %v, got %v", testState, c.state)
 	}
 }
+
+func TestSetSequenceStateAction(t *testing.T) {
+	step := 2
+
+	var testCases = []struct {
+		state  models.SequenceState
+		status int
+	}{
+		{models.SequenceState{Action: models.SeqSeek, Step: &step}, http.StatusOK},
+		{models.SequenceState{Action: models.SeqNext}, http.StatusOK},
+		{models.SequenceState{Name: tests[0].Name, State: models.SeqRunning, Offset: 1500}, http.StatusOK},
+		{models.SequenceState{Action: "rewind"}, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		data, err := json.Marshal(tc.state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/api/v1/seqctrl", strings.NewReader(string(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := TestController{}
+
+		rr := httptest.NewRecorder()
+
+		newRouter(&c, false).ServeHTTP(rr, req)
+
+		if rr.Code != tc.status {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", data, rr.Code, tc.status)
+		}
+
+		if tc.status == http.StatusOK && !reflect.DeepEqual(tc.state, c.state) {
+			t.Errorf("expected %v, got %v", tc.state, c.state)
+		}
+	}
+}
+
+func TestListFailedCommands(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/diagnostics/failed-commands?bridge=hall", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := TestController{}
+	c.failed = []models.FailedCommand{
+		{Bridge: "hall", Command: "zone 1 light switch on", Attempts: 3, Error: "can't allocate connection", Time: time.Date(2021, 3, 14, 18, 1, 2, 0, time.UTC)},
+	}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if c.bridge != "hall" {
+		t.Errorf("expected %s, got %s", "hall", c.bridge)
+	}
+
+	var failed []models.FailedCommand
+
+	err = json.NewDecoder(rr.Body).Decode(&failed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.failed, failed) {
+		t.Errorf("expected %v, got %v", c.failed, failed)
+	}
+
+	req, err = http.NewRequest("GET", "/api/v1/diagnostics/failed-commands?bridge="+testUnknownBridge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestListBridges(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/diagnostics/bridges", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := TestController{}
+	c.statuses = []models.BridgeStatus{
+		{Bridge: "hall", Circuit: models.Circuit{State: models.CircuitOpen, Failures: 3, Changed: time.Date(2021, 3, 14, 18, 1, 2, 0, time.UTC)}},
+	}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&c, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var statuses []models.BridgeStatus
+
+	err = json.NewDecoder(rr.Body).Decode(&statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.statuses, statuses) {
+		t.Errorf("expected %v, got %v", c.statuses, statuses)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	newRouter(&TestController{}, false).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var health models.Health
+
+	err = json.NewDecoder(rr.Body).Decode(&health)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if health.Status != models.HealthOK {
+		t.Errorf("expected %s, got %s", models.HealthOK, health.Status)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	cases := []struct {
+		health models.Health
+		code   int
+	}{
+		{
+			health: models.Health{Status: models.HealthOK, Checks: []models.Check{
+				{Name: models.CheckStore, Status: models.HealthOK},
+				{Name: models.CheckBridge, Bridge: "hall", Status: models.HealthOK, Detail: "bridge reached at 2021-03-14T18:01:02Z"},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			health: models.Health{Status: models.HealthFailed, Checks: []models.Check{
+				{Name: models.CheckStore, Status: models.HealthOK},
+				{Name: models.CheckBridge, Bridge: "hall", Status: models.HealthFailed, Detail: "bridge not reached yet"},
+			}},
+			code: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tc := range cases {
+		req, err := http.NewRequest("GET", "/readyz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := TestController{health: tc.health}
+
+		rr := httptest.NewRecorder()
+
+		newRouter(&c, false).ServeHTTP(rr, req)
+
+		if rr.Code != tc.code {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.code)
+		}
+
+		var health models.Health
+
+		err = json.NewDecoder(rr.Body).Decode(&health)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tc.health, health) {
+			t.Errorf("expected %v, got %v", tc.health, health)
+		}
+	}
+}
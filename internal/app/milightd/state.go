@@ -0,0 +1,216 @@
+package milightd
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+// stateSaveDelay is the time state changes are gathered before they're saved into store.
+const stateSaveDelay = time.Second
+
+// StateTracker keeps state of the light in the bridge zones, updated with executed commands.
+// State changes are saved into store at most once per save delay, off the command loop.
+type StateTracker struct {
+	bridge    string
+	profile   *Profile
+	store     StateStorer
+	zones     [models.MaxZone + 1]models.LightState
+	saveDelay time.Duration
+	save      *time.Timer
+	closed    bool
+	mux       sync.Mutex
+	saving    sync.Mutex
+}
+
+// NewStateTracker returns initialized StateTracker object.
+func NewStateTracker(bridge string, profile *Profile) *StateTracker {
+	s := StateTracker{
+		bridge:    bridge,
+		profile:   profile,
+		saveDelay: stateSaveDelay,
+	}
+	for zone := range s.zones {
+		s.zones[zone].Bridge = bridge
+		s.zones[zone].Zone = zone
+	}
+	return &s
+}
+
+// State returns state of the light in zones paired with the bridge.
+func (s *StateTracker) State() []models.LightState {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	states := make([]models.LightState, 0, models.MaxZone)
+	for _, state := range s.zones[models.ZoneAll+1:] {
+		states = append(states, state)
+	}
+	return states
+}
+
+// Persist restores state from previous run and saves every state change into store.
+func (s *StateTracker) Persist(store StateStorer, states []models.LightState) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, state := range states {
+		if state.Zone <= models.ZoneAll || state.Zone > models.MaxZone {
+			continue
+		}
+		state.Bridge = s.bridge
+		s.zones[state.Zone] = state
+	}
+	s.store = store
+}
+
+// Record updates state with the command execution result.
+// Light state changes only when the command was sent successfully,
+// change time and store are updated only when the command changes the state.
+// Command addressed to all zones changes zones supporting it.
+func (s *StateTracker) Record(c Command, err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := time.Now()
+
+	var zone byte
+	var update func(*models.LightState, models.Capabilities) bool
+
+	switch c := c.(type) {
+	case *LightSwitch:
+		zone = c.zone
+		on := c.on
+		if on != models.On && on != models.Night {
+			on = models.Off
+		}
+		update = func(state *models.LightState, caps models.Capabilities) bool {
+			if on == models.Night && !caps.Night || equalString(state.Switch, on) {
+				return false
+			}
+			state.Switch = &on
+			state.Changed.Switch = &now
+			return true
+		}
+	case *LightBrightness:
+		zone = c.zone
+		level := c.level
+		update = func(state *models.LightState, caps models.Capabilities) bool {
+			if equalInt(state.Brightness, level) {
+				return false
+			}
+			state.Brightness = &level
+			state.Changed.Brightness = &now
+			return true
+		}
+	case *LightColor:
+		zone = c.zone
+		color := c.color
+		update = func(state *models.LightState, caps models.Capabilities) bool {
+			if !caps.Color && !caps.White || equalString(state.Color, color) {
+				return false
+			}
+			state.Color = &color
+			state.Hue = nil
+			state.Changed.Color = &now
+			return true
+		}
+	case *LightHue:
+		zone = c.zone
+		hue := int(c.hue)
+		update = func(state *models.LightState, caps models.Capabilities) bool {
+			if !caps.Color || equalInt(state.Hue, hue) {
+				return false
+			}
+			state.Hue = &hue
+			state.Color = nil
+			state.Changed.Hue = &now
+			return true
+		}
+	default:
+		return
+	}
+
+	status := models.SendStatus{Time: now, Success: err == nil}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	zones := []byte{zone}
+	if zone == byte(models.ZoneAll) {
+		zones = []byte{1, 2, 3, 4}
+	}
+
+	changed := false
+
+	for _, z := range zones {
+		if int(z) > models.MaxZone {
+			continue
+		}
+		state := &s.zones[z]
+		state.LastSend = &status
+		if err == nil && update(state, s.profile.Capabilities(int(z))) {
+			changed = true
+		}
+	}
+
+	if !changed || s.store == nil {
+		return
+	}
+	if s.closed {
+		// closed tracker saves late changes at once
+		go s.write()
+		return
+	}
+	if s.save == nil {
+		s.save = time.AfterFunc(s.saveDelay, s.flush)
+	}
+}
+
+// Close saves state changes waiting for the save delay.
+func (s *StateTracker) Close() {
+	s.mux.Lock()
+	save := s.save
+	s.save = nil
+	s.closed = true
+	s.mux.Unlock()
+	// stopped timer didn't save the changes, the running one saves them
+	if save != nil && save.Stop() {
+		s.write()
+	}
+}
+
+// flush saves state changes after the save delay.
+func (s *StateTracker) flush() {
+	s.mux.Lock()
+	s.save = nil
+	s.mux.Unlock()
+	s.write()
+}
+
+// write saves the current state into store, writes are serialized so the last one saves the latest state.
+func (s *StateTracker) write() {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	s.mux.Lock()
+	store := s.store
+	states := make([]models.LightState, models.MaxZone)
+	copy(states, s.zones[models.ZoneAll+1:])
+	s.mux.Unlock()
+
+	err := store.Save(s.bridge, states)
+	if err != nil {
+		log.Printf("milightd %s can't save light state: %s", s.bridge, err)
+	}
+}
+
+// equalString checks whether optional value is set to v.
+func equalString(p *string, v string) bool {
+	return p != nil && *p == v
+}
+
+// equalInt checks whether optional value is set to v.
+func equalInt(p *int, v int) bool {
+	return p != nil && *p == v
+}
@@ -0,0 +1,153 @@
+package milightd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestStateTrackerRecord(t *testing.T) {
+	s := NewStateTracker(DefaultBridgeName, testProfile(t, BulbRGBW, map[int]string{3: BulbCCT}))
+
+	s.Record(&LightSwitch{zone: 2, on: models.On}, nil)
+	s.Record(&LightColor{zone: 2, color: "red"}, nil)
+	s.Record(&LightBrightness{zone: 2, level: 32}, nil)
+
+	state := s.State()[1]
+
+	if state.Bridge != DefaultBridgeName || state.Zone != 2 {
+		t.Errorf("expected %s zone %d, got %s zone %d", DefaultBridgeName, 2, state.Bridge, state.Zone)
+	}
+	if state.Switch == nil || *state.Switch != models.On || state.Changed.Switch == nil {
+		t.Errorf("expected switch %s, got %v", models.On, state.Switch)
+	}
+	if state.Color == nil || *state.Color != "red" || state.Changed.Color == nil {
+		t.Errorf("expected color %s, got %v", "red", state.Color)
+	}
+	if state.Brightness == nil || *state.Brightness != 32 || state.Changed.Brightness == nil {
+		t.Errorf("expected brightness %d, got %v", 32, state.Brightness)
+	}
+	if state.LastSend == nil || !state.LastSend.Success {
+		t.Errorf("expected successful send, got %v", state.LastSend)
+	}
+
+	s.Record(&LightHue{zone: 2, hue: 10}, nil)
+
+	state = s.State()[1]
+
+	if state.Hue == nil || *state.Hue != 10 || state.Color != nil {
+		t.Errorf("expected hue %d replacing color, got hue %v color %v", 10, state.Hue, state.Color)
+	}
+}
+
+func TestStateTrackerRecordFailure(t *testing.T) {
+	s := NewStateTracker(DefaultBridgeName, testProfile(t, BulbRGBW, nil))
+
+	s.Record(&LightSwitch{zone: 1, on: models.On}, nil)
+	s.Record(&LightSwitch{zone: 1, on: models.Off}, errors.New("i/o timeout"))
+
+	state := s.State()[0]
+
+	if state.Switch == nil || *state.Switch != models.On {
+		t.Errorf("expected switch %s kept, got %v", models.On, state.Switch)
+	}
+	if state.LastSend == nil || state.LastSend.Success || state.LastSend.Error != "i/o timeout" {
+		t.Errorf("expected failed send, got %v", state.LastSend)
+	}
+}
+
+func TestStateTrackerRecordAllZones(t *testing.T) {
+	s := NewStateTracker(DefaultBridgeName, testProfile(t, BulbRGBW, map[int]string{3: BulbCCT}))
+
+	s.Record(&LightSwitch{zone: byte(models.ZoneAll), on: models.On}, nil)
+	s.Record(&LightHue{zone: byte(models.ZoneAll), hue: 20}, nil)
+
+	for _, state := range s.State() {
+		if state.Switch == nil || *state.Switch != models.On {
+			t.Errorf("zone %d: expected switch %s, got %v", state.Zone, models.On, state.Switch)
+		}
+		if state.Zone == 3 {
+			if state.Hue != nil {
+				t.Errorf("zone %d: expected no hue, got %d", state.Zone, *state.Hue)
+			}
+			continue
+		}
+		if state.Hue == nil || *state.Hue != 20 {
+			t.Errorf("zone %d: expected hue %d, got %v", state.Zone, 20, state.Hue)
+		}
+	}
+}
+
+func TestStateTrackerPersist(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	store, err := NewStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	off := models.Off
+	s := NewStateTracker(DefaultBridgeName, testProfile(t, BulbRGBW, nil))
+	s.Persist(store, []models.LightState{{Zone: 3, Switch: &off}})
+
+	if state := s.State()[2]; state.Switch == nil || *state.Switch != models.Off || state.Bridge != DefaultBridgeName {
+		t.Errorf("expected restored switch %s, got %v", models.Off, state.Switch)
+	}
+
+	s.Record(&LightSwitch{zone: 1, on: models.On}, nil)
+	s.Close()
+
+	states, err := store.Load(DefaultBridgeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != models.MaxZone {
+		t.Fatalf("expected %d zones saved, got %d", models.MaxZone, len(states))
+	}
+	if states[0].Switch == nil || *states[0].Switch != models.On {
+		t.Errorf("expected saved switch %s, got %v", models.On, states[0].Switch)
+	}
+	if states[2].Switch == nil || *states[2].Switch != models.Off {
+		t.Errorf("expected saved switch %s, got %v", models.Off, states[2].Switch)
+	}
+}
+
+func TestStateTrackerSaveDelay(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	store, err := NewStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStateTracker(DefaultBridgeName, testProfile(t, BulbRGBW, nil))
+	s.saveDelay = 100 * time.Millisecond
+	s.Persist(store, nil)
+	defer s.Close()
+
+	for level := 1; level <= 10; level++ {
+		s.Record(&LightBrightness{zone: 1, level: level}, nil)
+	}
+
+	states, err := store.Load(DefaultBridgeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states != nil {
+		t.Errorf("expected state not saved before the save delay, got %v", states)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	states, err = store.Load(DefaultBridgeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != models.MaxZone || states[0].Brightness == nil || *states[0].Brightness != 10 {
+		t.Errorf("expected saved brightness %d, got %v", 10, states)
+	}
+}
@@ -0,0 +1,51 @@
+package milightd
+
+import (
+	"os"
+
+	scribble "github.com/nanobox-io/golang-scribble"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+// StateStorer represents light state store interface.
+type StateStorer interface {
+	// Load retrieves state of the light in zones paired with the bridge from store.
+	Load(string) ([]models.LightState, error)
+	// Save stores state of the light in zones paired with the bridge.
+	Save(string, []models.LightState) error
+}
+
+const (
+	stateCollection string = "state"
+)
+
+// StateStore represents light state store.
+type StateStore struct {
+	db *scribble.Driver
+}
+
+// NewStateStore returns initialized StateStore object.
+func NewStateStore(dir string) (*StateStore, error) {
+	db, err := scribble.New(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &StateStore{db: db}, nil
+}
+
+// Load retrieves state of the light in zones paired with the bridge from store, nil when never stored.
+func (s *StateStore) Load(bridge string) ([]models.LightState, error) {
+	var states []models.LightState
+	if err := s.db.Read(stateCollection, bridge, &states); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return states, nil
+}
+
+// Save stores state of the light in zones paired with the bridge.
+func (s *StateStore) Save(bridge string, states []models.LightState) error {
+	return s.db.Write(stateCollection, bridge, states)
+}
@@ -0,0 +1,46 @@
+package milightd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestStateStore(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	store, err := NewStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := store.Load(DefaultBridgeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states != nil {
+		t.Errorf("expected no state, got %v", states)
+	}
+
+	on := models.On
+	brightness := 50
+	expected := []models.LightState{
+		{Bridge: DefaultBridgeName, Zone: 1, Switch: &on, Brightness: &brightness},
+		{Bridge: DefaultBridgeName, Zone: 2},
+	}
+
+	err = store.Save(DefaultBridgeName, expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err = store.Load(DefaultBridgeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("expected %v, got %v", expected, states)
+	}
+}
@@ -0,0 +1,424 @@
+// Package ibox implements Mi-Light iBox (v6) bridge protocol with zone addressing.
+package ibox
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sgrzywna/milight"
+)
+
+const (
+	// ZoneAll addresses all zones paired with the bridge.
+	ZoneAll byte = 0x00
+	// MaxZone is the highest zone number supported by the bridge.
+	MaxZone byte = 0x04
+
+	defaultKeepAlivePeriod time.Duration = 5 * time.Second
+
+	defaultReadDeadline time.Duration = 1 * time.Second
+
+	maxLevel byte = 0x64
+
+	createSessionResponseLength int = 22
+
+	keepAliveResponseLength int = 12
+)
+
+var (
+	// ErrInvalidResponse is returned when Mi-Light device responds with invalid response.
+	ErrInvalidResponse = milight.ErrInvalidResponse
+	// ErrInvalidZone is returned when command addresses non-existing zone.
+	ErrInvalidZone = fmt.Errorf("invalid zone")
+	// ErrUnsupportedCommand is returned when device type doesn't support the command.
+	ErrUnsupportedCommand = fmt.Errorf("unsupported command")
+)
+
+// DeviceType represents type of the Mi-Light device controlled through the bridge.
+type DeviceType byte
+
+const (
+	// BridgeLamp is the lamp built into the iBox bridge.
+	BridgeLamp DeviceType = 0x00
+	// CCT is the dual white bulb.
+	CCT DeviceType = 0x01
+	// RGBW is the color bulb with white LEDs.
+	RGBW DeviceType = 0x07
+	// RGBWW is the color bulb with dual white LEDs (RGB+CCT).
+	RGBWW DeviceType = 0x08
+)
+
+// Zones maps zone number into type of the device paired with the zone, ZoneAll entry is not used.
+type Zones [MaxZone + 1]DeviceType
+
+// operation represents light control operation.
+type operation int
+
+const (
+	opOn operation = iota
+	opOff
+	opNight
+	opWhite
+	opColor
+	opBrightness
+	opSaturation
+	opTemperature
+	opMode
+	opSpeedUp
+	opSpeedDown
+	opLink
+	opUnlink
+)
+
+// code represents command code with either fixed or caller provided argument.
+type code struct {
+	prefix  byte
+	cmd     byte
+	arg     byte
+	withArg bool
+}
+
+const (
+	// lightPrefix starts light control commands.
+	lightPrefix byte = 0x31
+	// linkPrefix starts command pairing device with the zone.
+	linkPrefix byte = 0x3D
+	// unlinkPrefix starts command unpairing device from the zone.
+	unlinkPrefix byte = 0x3E
+)
+
+// commandSets maps device type operations into command codes.
+var commandSets = map[DeviceType]map[operation]code{
+	BridgeLamp: {
+		opOn:         {cmd: 0x03, arg: 0x03},
+		opOff:        {cmd: 0x03, arg: 0x04},
+		opWhite:      {cmd: 0x03, arg: 0x05},
+		opColor:      {cmd: 0x01, withArg: true},
+		opBrightness: {cmd: 0x02, withArg: true},
+		opMode:       {cmd: 0x04, withArg: true},
+		opSpeedUp:    {cmd: 0x03, arg: 0x02},
+		opSpeedDown:  {cmd: 0x03, arg: 0x01},
+	},
+	CCT: {
+		opOn:          {cmd: 0x01, arg: 0x07},
+		opOff:         {cmd: 0x01, arg: 0x08},
+		opNight:       {cmd: 0x01, arg: 0x06},
+		opBrightness:  {cmd: 0x02, withArg: true},
+		opTemperature: {cmd: 0x03, withArg: true},
+		opLink:        {prefix: linkPrefix},
+		opUnlink:      {prefix: unlinkPrefix},
+	},
+	RGBW: {
+		opOn:         {cmd: 0x03, arg: 0x01},
+		opOff:        {cmd: 0x03, arg: 0x02},
+		opNight:      {cmd: 0x03, arg: 0x06},
+		opWhite:      {cmd: 0x03, arg: 0x05},
+		opColor:      {cmd: 0x01, withArg: true},
+		opBrightness: {cmd: 0x02, withArg: true},
+		opMode:       {cmd: 0x04, withArg: true},
+		opSpeedUp:    {cmd: 0x03, arg: 0x03},
+		opSpeedDown:  {cmd: 0x03, arg: 0x04},
+		opLink:       {prefix: linkPrefix},
+		opUnlink:     {prefix: unlinkPrefix},
+	},
+	RGBWW: {
+		opOn:          {cmd: 0x04, arg: 0x01},
+		opOff:         {cmd: 0x04, arg: 0x02},
+		opNight:       {cmd: 0x04, arg: 0x05},
+		opWhite:       {cmd: 0x05, arg: maxLevel},
+		opColor:       {cmd: 0x01, withArg: true},
+		opSaturation:  {cmd: 0x02, withArg: true},
+		opBrightness:  {cmd: 0x03, withArg: true},
+		opTemperature: {cmd: 0x05, withArg: true},
+		opMode:        {cmd: 0x06, withArg: true},
+		opSpeedUp:     {cmd: 0x04, arg: 0x03},
+		opSpeedDown:   {cmd: 0x04, arg: 0x04},
+		opLink:        {prefix: linkPrefix},
+		opUnlink:      {prefix: unlinkPrefix},
+	},
+}
+
+// Bridge represents Mi-Light iBox bridge controller.
+type Bridge struct {
+	zones        Zones
+	conn         net.Conn
+	quit         chan struct{}
+	seqNum       byte
+	sessionID    [2]byte
+	lastActivity time.Time
+	mux          sync.Mutex
+	responseMux  sync.Mutex
+	lastResponse time.Time
+}
+
+// NewBridge returns initialized Mi-Light iBox bridge controller with devices of given types paired with zones.
+func NewBridge(addr string, port int, zones Zones) (*Bridge, error) {
+	for _, device := range zones[ZoneAll+1:] {
+		if _, ok := commandSets[device]; !ok {
+			return nil, fmt.Errorf("unsupported device type 0x%02X", byte(device))
+		}
+	}
+	d := net.Dialer{Timeout: 1 * time.Second}
+	conn, err := d.Dial("udp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	b := Bridge{
+		zones: zones,
+		conn:  conn,
+		quit:  make(chan struct{}),
+	}
+	err = b.createSession()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go b.keepAliveLoop()
+	return &b, nil
+}
+
+// Close closes connection to Mi-Light device.
+func (b *Bridge) Close() error {
+	b.quit <- struct{}{}
+	<-b.quit
+	return b.conn.Close()
+}
+
+// On turns light on.
+func (b *Bridge) On(zone byte) error {
+	return b.send(zone, opOn, 0)
+}
+
+// Off turns light off.
+func (b *Bridge) Off(zone byte) error {
+	return b.send(zone, opOff, 0)
+}
+
+// Night turns night light on.
+func (b *Bridge) Night(zone byte) error {
+	return b.send(zone, opNight, 0)
+}
+
+// Color sets light color.
+func (b *Bridge) Color(zone byte, color byte) error {
+	return b.send(zone, opColor, color)
+}
+
+// White sets white light.
+func (b *Bridge) White(zone byte) error {
+	return b.send(zone, opWhite, 0)
+}
+
+// Brightness sets brightness level.
+func (b *Bridge) Brightness(zone byte, brightness byte) error {
+	return b.send(zone, opBrightness, limit(brightness))
+}
+
+// Saturation sets color saturation level.
+func (b *Bridge) Saturation(zone byte, saturation byte) error {
+	return b.send(zone, opSaturation, limit(saturation))
+}
+
+// Temperature sets white light temperature, from the warmest (0x00) to the coolest (0x64).
+func (b *Bridge) Temperature(zone byte, temperature byte) error {
+	return b.send(zone, opTemperature, limit(temperature))
+}
+
+// Mode starts built-in effect mode.
+func (b *Bridge) Mode(zone byte, mode byte) error {
+	return b.send(zone, opMode, mode)
+}
+
+// SpeedUp increases effect mode speed.
+func (b *Bridge) SpeedUp(zone byte) error {
+	return b.send(zone, opSpeedUp, 0)
+}
+
+// SpeedDown decreases effect mode speed.
+func (b *Bridge) SpeedDown(zone byte) error {
+	return b.send(zone, opSpeedDown, 0)
+}
+
+// Link pairs device powered on within last few seconds with the zone.
+func (b *Bridge) Link(zone byte) error {
+	return b.send(zone, opLink, 0)
+}
+
+// Unlink unpairs device powered on within last few seconds from the zone.
+func (b *Bridge) Unlink(zone byte) error {
+	return b.send(zone, opUnlink, 0)
+}
+
+// LastResponse returns time of the last response received from the bridge, including keep alive ones.
+func (b *Bridge) LastResponse() time.Time {
+	b.responseMux.Lock()
+	defer b.responseMux.Unlock()
+	return b.lastResponse
+}
+
+// KeepAlive sustains session.
+func (b *Bridge) KeepAlive() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	packet := []byte{0xD0, 0x00, 0x00, 0x00, 0x02, b.sessionID[0], b.sessionID[1], 0x00}
+	resp, err := b.roundTrip(packet)
+	if err != nil {
+		return err
+	}
+	if len(resp) != keepAliveResponseLength {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// createSession creates Mi-Light communication session.
+func (b *Bridge) createSession() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	packet := []byte{
+		0x20, 0x00, 0x00, 0x00, 0x16, 0x02, 0x62, 0x3A,
+		0xD5, 0xED, 0xA3, 0x01, 0xAE, 0x08, 0x2D, 0x46,
+		0x61, 0x41, 0xA7, 0xF6, 0xDC, 0xAF, 0xD3, 0xE6,
+		0x00, 0x00, 0x1E,
+	}
+	resp, err := b.roundTrip(packet)
+	if err != nil {
+		return err
+	}
+	if len(resp) != createSessionResponseLength {
+		return ErrInvalidResponse
+	}
+	b.sessionID[0] = resp[19]
+	b.sessionID[1] = resp[20]
+	return nil
+}
+
+// keepAliveLoop periodically sends keep alive packets to sustain session.
+func (b *Bridge) keepAliveLoop() {
+	defer func() { b.quit <- struct{}{} }()
+	for {
+		select {
+		case <-b.quit:
+			return
+		case <-time.After(2 * time.Second):
+			if b.idleTime() > defaultKeepAlivePeriod {
+				b.KeepAlive()
+			}
+		}
+	}
+}
+
+// idleTime returns time elapsed since the last communication with the bridge.
+func (b *Bridge) idleTime() time.Duration {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return time.Since(b.lastActivity)
+}
+
+// sendCommand sends command addressed to the zone to the Mi-Light device.
+func (b *Bridge) sendCommand(zone byte, cmd []byte) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.seqNum++
+	seq := b.seqNum
+	packet := []byte{0x80, 0x00, 0x00, 0x00, 0x11, b.sessionID[0], b.sessionID[1], 0x00, seq, 0x00}
+	packet = append(packet, cmd...)
+	packet = append(packet, zone, 0x00)
+	packet = append(packet, checksum(packet))
+	resp, err := b.roundTrip(packet)
+	if err != nil {
+		return err
+	}
+	commandResponse := []byte{0x88, 0x00, 0x00, 0x00, 0x03, 0x00, seq, 0x00}
+	if !bytes.Equal(commandResponse, resp) {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// send sends operation command with the argument to the zone.
+// Command addressed to all zones is sent once for every paired device type supporting it.
+func (b *Bridge) send(zone byte, op operation, arg byte) error {
+	if zone > MaxZone {
+		return ErrInvalidZone
+	}
+	devices := b.zones[zone : zone+1]
+	if zone == ZoneAll {
+		devices = b.zones[ZoneAll+1:]
+	}
+	sent := make(map[DeviceType]bool)
+	for _, device := range devices {
+		if sent[device] {
+			continue
+		}
+		c, ok := commandSets[device][op]
+		if !ok {
+			if zone == ZoneAll {
+				continue
+			}
+			return ErrUnsupportedCommand
+		}
+		prefix := c.prefix
+		if prefix == 0 {
+			prefix = lightPrefix
+		}
+		cmd := []byte{prefix, 0x00, 0x00, byte(device), c.cmd, c.arg, 0x00, 0x00, 0x00}
+		if c.withArg {
+			cmd[5] = arg
+			if op == opColor {
+				cmd[6], cmd[7], cmd[8] = arg, arg, arg
+			}
+		}
+		err := b.sendCommand(zone, cmd)
+		if err != nil {
+			return err
+		}
+		sent[device] = true
+	}
+	if len(sent) == 0 {
+		return ErrUnsupportedCommand
+	}
+	return nil
+}
+
+// roundTrip sends packet to the Mi-Light device and returns the response.
+func (b *Bridge) roundTrip(packet []byte) ([]byte, error) {
+	_, err := b.conn.Write(packet)
+	if err != nil {
+		return nil, err
+	}
+	b.lastActivity = time.Now()
+	buf := make([]byte, 1024)
+	b.conn.SetReadDeadline(time.Now().Add(defaultReadDeadline))
+	n, err := b.conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	b.responseMux.Lock()
+	b.lastResponse = time.Now()
+	b.responseMux.Unlock()
+	return buf[:n], nil
+}
+
+// limit limits value to the maximal level accepted by the device.
+func limit(v byte) byte {
+	if v > maxLevel {
+		return maxLevel
+	}
+	return v
+}
+
+// checksum calculates checksum for input data.
+func checksum(data []byte) byte {
+	var chksum byte
+	if len(data) > 10 {
+		for _, b := range data[len(data)-11:] {
+			chksum += b
+		}
+	}
+	return chksum
+}
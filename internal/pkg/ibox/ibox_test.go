@@ -0,0 +1,288 @@
+package ibox
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	WB1 byte = 0x98
+	WB2 byte = 0x65
+)
+
+func TestChecksum(t *testing.T) {
+	packet := []byte{
+		0x31, 0x00, 0x00, 0x08, 0x04, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00,
+	}
+	chksum := checksum(packet)
+	if chksum != 0x3F {
+		t.Errorf("checksum error: 0x%X\n", chksum)
+	}
+}
+
+func TestSendCommandZone(t *testing.T) {
+	var packet = []byte{
+		0x80, 0x00, 0x00, 0x00, 0x11, WB1, WB2, 0x00,
+		0x01, 0x00, 0x31, 0x00, 0x00, 0x00, 0x03, 0x03,
+		0x00, 0x00, 0x00, 0x03, 0x00, 0x3A,
+	}
+
+	var res = []byte{0x88, 0x00, 0x00, 0x00, 0x03, 0x00, 0x01, 0x00}
+
+	pc := testListen(t)
+	defer pc.Close()
+
+	go func() {
+		handleInitSession(t, pc)
+		buffer := make([]byte, 1024)
+		n, addr, err := pc.ReadFrom(buffer)
+		if err != nil {
+			t.Errorf("err: %s", err)
+			return
+		}
+		if !bytes.Equal(packet, buffer[:n]) {
+			t.Errorf("expected %v, got %v", packet, buffer[:n])
+		}
+		_, err = pc.WriteTo(res, addr)
+		if err != nil {
+			t.Errorf("err: %s", err)
+		}
+	}()
+
+	b := testBridge(t, pc, Zones{})
+	defer b.Close()
+
+	err := b.On(3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSendCommandLink(t *testing.T) {
+	var packet = []byte{
+		0x80, 0x00, 0x00, 0x00, 0x11, WB1, WB2, 0x00,
+		0x01, 0x00, 0x3D, 0x00, 0x00, 0x07, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x02, 0x00, 0x46,
+	}
+
+	var res = []byte{0x88, 0x00, 0x00, 0x00, 0x03, 0x00, 0x01, 0x00}
+
+	pc := testListen(t)
+	defer pc.Close()
+
+	go func() {
+		handleInitSession(t, pc)
+		buffer := make([]byte, 1024)
+		n, addr, err := pc.ReadFrom(buffer)
+		if err != nil {
+			t.Errorf("err: %s", err)
+			return
+		}
+		if !bytes.Equal(packet, buffer[:n]) {
+			t.Errorf("expected %v, got %v", packet, buffer[:n])
+		}
+		_, err = pc.WriteTo(res, addr)
+		if err != nil {
+			t.Errorf("err: %s", err)
+		}
+	}()
+
+	b := testBridge(t, pc, Zones{RGBW, RGBW, RGBW, RGBW, RGBW})
+	defer b.Close()
+
+	err := b.Link(2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSendCommandInvalidZone(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	go handleInitSession(t, pc)
+
+	b := testBridge(t, pc, Zones{})
+	defer b.Close()
+
+	err := b.On(MaxZone + 1)
+	if err != ErrInvalidZone {
+		t.Fatalf("expected %v, got %v", ErrInvalidZone, err)
+	}
+}
+
+func TestSendCommandDeviceType(t *testing.T) {
+	var packet = []byte{
+		0x80, 0x00, 0x00, 0x00, 0x11, WB1, WB2, 0x00,
+		0x01, 0x00, 0x31, 0x00, 0x00, 0x08, 0x05, 0x32,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x71,
+	}
+
+	var res = []byte{0x88, 0x00, 0x00, 0x00, 0x03, 0x00, 0x01, 0x00}
+
+	pc := testListen(t)
+	defer pc.Close()
+
+	go func() {
+		handleInitSession(t, pc)
+		buffer := make([]byte, 1024)
+		n, addr, err := pc.ReadFrom(buffer)
+		if err != nil {
+			t.Errorf("err: %s", err)
+			return
+		}
+		if !bytes.Equal(packet, buffer[:n]) {
+			t.Errorf("expected %v, got %v", packet, buffer[:n])
+		}
+		_, err = pc.WriteTo(res, addr)
+		if err != nil {
+			t.Errorf("err: %s", err)
+		}
+	}()
+
+	b := testBridge(t, pc, Zones{RGBWW, RGBWW, RGBW, RGBW, CCT})
+	defer b.Close()
+
+	err := b.Temperature(1, 0x32)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSendCommandUnsupported(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	go handleInitSession(t, pc)
+
+	b := testBridge(t, pc, Zones{RGBW, RGBW, RGBW, RGBW, RGBW})
+	defer b.Close()
+
+	err := b.Temperature(1, 0x32)
+	if err != ErrUnsupportedCommand {
+		t.Fatalf("expected %v, got %v", ErrUnsupportedCommand, err)
+	}
+}
+
+func TestSendCommandAllZones(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	var devices []byte
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		handleInitSession(t, pc)
+		for i := 0; i < 2; i++ {
+			buffer := make([]byte, 1024)
+			n, addr, err := pc.ReadFrom(buffer)
+			if err != nil {
+				t.Errorf("err: %s", err)
+				return
+			}
+			if n != 22 || buffer[19] != ZoneAll {
+				t.Errorf("unexpected packet %v", buffer[:n])
+			}
+			devices = append(devices, buffer[13])
+			res := []byte{0x88, 0x00, 0x00, 0x00, 0x03, 0x00, buffer[8], 0x00}
+			_, err = pc.WriteTo(res, addr)
+			if err != nil {
+				t.Errorf("err: %s", err)
+			}
+		}
+	}()
+
+	b := testBridge(t, pc, Zones{RGBW, RGBWW, RGBW, CCT, RGBWW})
+	defer b.Close()
+
+	err := b.Temperature(ZoneAll, 0x10)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	<-done
+
+	expected := []byte{byte(RGBWW), byte(CCT)}
+	if !bytes.Equal(expected, devices) {
+		t.Errorf("expected %v, got %v", expected, devices)
+	}
+}
+
+func TestLastResponse(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	go handleInitSession(t, pc)
+
+	b := testBridge(t, pc, Zones{})
+	defer b.Close()
+
+	if time.Since(b.LastResponse()) > time.Second {
+		t.Errorf("expected response to session request, got %s", b.LastResponse())
+	}
+}
+
+func testListen(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return pc
+}
+
+func testBridge(t *testing.T, pc net.PacketConn, zones Zones) *Bridge {
+	host, port, err := net.SplitHostPort(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	iPort, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := NewBridge(host, iPort, zones)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if b.sessionID[0] != WB1 || b.sessionID[1] != WB2 {
+		t.Fatalf("expected [0x%X, 0x%X], got [0x%X, 0x%X]", WB1, WB2, b.sessionID[0], b.sessionID[1])
+	}
+
+	return b
+}
+
+func handleInitSession(t *testing.T, pc net.PacketConn) {
+	var cmd = []byte{
+		0x20, 0x00, 0x00, 0x00, 0x16, 0x02, 0x62, 0x3A,
+		0xD5, 0xED, 0xA3, 0x01, 0xAE, 0x08, 0x2D, 0x46,
+		0x61, 0x41, 0xA7, 0xF6, 0xDC, 0xAF, 0xD3, 0xE6,
+		0x00, 0x00, 0x1E,
+	}
+
+	var res = []byte{
+		0x28, 0x00, 0x00, 0x00, 0x11, 0x00, 0x02, 0xAC,
+		0xCF, 0x23, 0xF5, 0x7A, 0xD4, 0x69, 0xF0, 0x3C,
+		0x23, 0x00, 0x01, WB1, WB2, 0x00,
+	}
+
+	buffer := make([]byte, 1024)
+	n, addr, err := pc.ReadFrom(buffer)
+	if err != nil {
+		t.Errorf("handleInitSession: err: %s", err)
+		return
+	}
+	if !bytes.Equal(cmd, buffer[:n]) {
+		t.Errorf("handleInitSession: expected %v, got %v", cmd, buffer[:n])
+	}
+	_, err = pc.WriteTo(res, addr)
+	if err != nil {
+		t.Errorf("handleInitSession: err: %s", err)
+	}
+}
@@ -0,0 +1,316 @@
+// Package legacy implements Mi-Light v3/v4/v5 WiFi bridge protocol with zone addressing.
+//
+// Legacy bridge accepts plain 3 bytes UDP commands without session and doesn't respond to them.
+// Dual white bulbs support only relative brightness and temperature changes,
+// absolute levels are set by stepping down to the minimum and up to the requested level.
+package legacy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+const (
+	// ZoneAll addresses all zones paired with the bridge.
+	ZoneAll = ibox.ZoneAll
+	// MaxZone is the highest zone number supported by the bridge.
+	MaxZone = ibox.MaxZone
+
+	// commandDelay is the minimal delay between commands, bridge drops commands sent faster.
+	commandDelay time.Duration = 100 * time.Millisecond
+
+	// maxLevel is the maximal temperature and saturation level, brightness is scaled from models.MaxBrightness.
+	maxLevel byte = 0x64
+
+	// redHue is the legacy hue value of the red color.
+	redHue byte = 0xB0
+
+	minBrightness byte = 0x02
+	maxBrightness byte = 0x1B
+
+	// cctSteps is the number of dual white bulb brightness and temperature steps.
+	cctSteps = 10
+
+	// unlinkRepeat is the number of on commands unpairing the bulb.
+	unlinkRepeat = 5
+)
+
+var (
+	// ErrInvalidZone is returned when command addresses non-existing zone.
+	ErrInvalidZone = ibox.ErrInvalidZone
+	// ErrUnsupportedCommand is returned when device type doesn't support the command.
+	ErrUnsupportedCommand = ibox.ErrUnsupportedCommand
+)
+
+// group represents zone selecting commands, index 0 addresses all zones.
+type group struct {
+	on    byte
+	off   byte
+	white byte
+	night byte
+}
+
+var rgbwGroups = [MaxZone + 1]group{
+	{on: 0x42, off: 0x41, white: 0xC2, night: 0xC1},
+	{on: 0x45, off: 0x46, white: 0xC5, night: 0xC6},
+	{on: 0x47, off: 0x48, white: 0xC7, night: 0xC8},
+	{on: 0x49, off: 0x4A, white: 0xC9, night: 0xCA},
+	{on: 0x4B, off: 0x4C, white: 0xCB, night: 0xCC},
+}
+
+var cctGroups = [MaxZone + 1]group{
+	{on: 0x35, off: 0x39, night: 0xB9},
+	{on: 0x38, off: 0x3B, night: 0xBB},
+	{on: 0x3D, off: 0x33, night: 0xB3},
+	{on: 0x37, off: 0x3A, night: 0xBA},
+	{on: 0x32, off: 0x36, night: 0xB6},
+}
+
+// RGBW bulb commands.
+const (
+	rgbwColor      byte = 0x40
+	rgbwBrightness byte = 0x4E
+	rgbwSpeedUp    byte = 0x44
+	rgbwSpeedDown  byte = 0x43
+)
+
+// CCT bulb commands.
+const (
+	cctBrightnessUp   byte = 0x3C
+	cctBrightnessDown byte = 0x34
+	cctWarmer         byte = 0x3E
+	cctCooler         byte = 0x3F
+)
+
+// command represents single legacy command with its argument.
+type command [2]byte
+
+// Bridge represents Mi-Light legacy WiFi bridge controller.
+type Bridge struct {
+	zones    ibox.Zones
+	conn     net.Conn
+	lastSent time.Time
+	mux      sync.Mutex
+}
+
+// NewBridge returns initialized Mi-Light legacy bridge controller with devices of given types paired with zones.
+func NewBridge(addr string, port int, zones ibox.Zones) (*Bridge, error) {
+	for _, device := range zones[ZoneAll+1:] {
+		if device != ibox.RGBW && device != ibox.CCT {
+			return nil, fmt.Errorf("unsupported device type 0x%02X", byte(device))
+		}
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	b := Bridge{
+		zones: zones,
+		conn:  conn,
+	}
+	return &b, nil
+}
+
+// Close closes connection to Mi-Light device.
+func (b *Bridge) Close() error {
+	return b.conn.Close()
+}
+
+// On turns light on.
+func (b *Bridge) On(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		return []command{{g.on}}
+	})
+}
+
+// Off turns light off.
+func (b *Bridge) Off(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		return []command{{g.off}}
+	})
+}
+
+// Night turns night light on.
+func (b *Bridge) Night(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		return []command{{g.off}, {g.night}}
+	})
+}
+
+// Color sets light color, given as iBox hue value.
+func (b *Bridge) Color(zone byte, color byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		if device != ibox.RGBW {
+			return nil
+		}
+		return []command{{g.on}, {rgbwColor, redHue - color}}
+	})
+}
+
+// White sets white light.
+func (b *Bridge) White(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		if device != ibox.RGBW {
+			return nil
+		}
+		return []command{{g.on}, {g.white}}
+	})
+}
+
+// Brightness sets brightness level, from 0 to models.MaxBrightness.
+func (b *Bridge) Brightness(zone byte, brightness byte) error {
+	level := int(brightness)
+	if level > models.MaxBrightness {
+		level = models.MaxBrightness
+	}
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		switch device {
+		case ibox.RGBW:
+			arg := minBrightness + byte(level*int(maxBrightness-minBrightness)/models.MaxBrightness)
+			return []command{{g.on}, {rgbwBrightness, arg}}
+		case ibox.CCT:
+			return steps(g, cctBrightnessDown, cctBrightnessUp, level, models.MaxBrightness)
+		}
+		return nil
+	})
+}
+
+// Saturation isn't supported by legacy bridge.
+func (b *Bridge) Saturation(zone byte, saturation byte) error {
+	return ErrUnsupportedCommand
+}
+
+// Temperature sets white light temperature, from the warmest (0x00) to the coolest (0x64).
+func (b *Bridge) Temperature(zone byte, temperature byte) error {
+	level := int(limit(temperature))
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		if device != ibox.CCT {
+			return nil
+		}
+		return steps(g, cctWarmer, cctCooler, level, int(maxLevel))
+	})
+}
+
+// Mode isn't supported by legacy bridge, which only cycles through effect modes.
+func (b *Bridge) Mode(zone byte, mode byte) error {
+	return ErrUnsupportedCommand
+}
+
+// SpeedUp increases effect mode speed.
+func (b *Bridge) SpeedUp(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		if device != ibox.RGBW {
+			return nil
+		}
+		return []command{{g.on}, {rgbwSpeedUp}}
+	})
+}
+
+// SpeedDown decreases effect mode speed.
+func (b *Bridge) SpeedDown(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		if device != ibox.RGBW {
+			return nil
+		}
+		return []command{{g.on}, {rgbwSpeedDown}}
+	})
+}
+
+// Link pairs device powered on within last few seconds with the zone.
+func (b *Bridge) Link(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		return []command{{g.on}}
+	})
+}
+
+// Unlink unpairs device powered on within last few seconds from the zone.
+func (b *Bridge) Unlink(zone byte) error {
+	return b.send(zone, func(device ibox.DeviceType, g group) []command {
+		var cmds []command
+		for i := 0; i < unlinkRepeat; i++ {
+			cmds = append(cmds, command{g.on})
+		}
+		return cmds
+	})
+}
+
+// send sends commands built for the device type paired with the zone.
+// Command addressed to all zones is sent once for every paired device type supporting it.
+func (b *Bridge) send(zone byte, build func(ibox.DeviceType, group) []command) error {
+	if zone > MaxZone {
+		return ErrInvalidZone
+	}
+	devices := b.zones[zone : zone+1]
+	if zone == ZoneAll {
+		devices = b.zones[ZoneAll+1:]
+	}
+	sent := make(map[ibox.DeviceType]bool)
+	for _, device := range devices {
+		if sent[device] {
+			continue
+		}
+		var cmds []command
+		switch device {
+		case ibox.RGBW:
+			cmds = build(device, rgbwGroups[zone])
+		case ibox.CCT:
+			cmds = build(device, cctGroups[zone])
+		}
+		if cmds == nil {
+			if zone == ZoneAll {
+				continue
+			}
+			return ErrUnsupportedCommand
+		}
+		for _, c := range cmds {
+			err := b.sendCommand(c)
+			if err != nil {
+				return err
+			}
+		}
+		sent[device] = true
+	}
+	if len(sent) == 0 {
+		return ErrUnsupportedCommand
+	}
+	return nil
+}
+
+// sendCommand sends command to the Mi-Light device, keeping minimal delay between commands.
+func (b *Bridge) sendCommand(c command) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if d := commandDelay - time.Since(b.lastSent); d > 0 {
+		time.Sleep(d)
+	}
+	_, err := b.conn.Write([]byte{c[0], c[1], 0x55})
+	b.lastSent = time.Now()
+	return err
+}
+
+// steps returns commands stepping dual white bulb level down to the minimum and up to the given level out of max.
+func steps(g group, down, up byte, level, max int) []command {
+	cmds := []command{{g.on}}
+	for i := 0; i < cctSteps; i++ {
+		cmds = append(cmds, command{down})
+	}
+	n := (level*cctSteps + max/2) / max
+	for i := 0; i < n; i++ {
+		cmds = append(cmds, command{up})
+	}
+	return cmds
+}
+
+// limit limits value to the maximal level accepted by the device.
+func limit(v byte) byte {
+	if v > maxLevel {
+		return maxLevel
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package legacy
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+	"github.com/sgrzywna/milightd/pkg/models"
+)
+
+func TestSendCommandZone(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	b := testBridge(t, pc, ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.RGBW, ibox.RGBW, ibox.RGBW})
+	defer b.Close()
+
+	err := b.On(3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := [][]byte{{0x49, 0x00, 0x55}}
+	testExpectPackets(t, pc, expected)
+}
+
+func TestSendCommandColor(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	b := testBridge(t, pc, ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.RGBW, ibox.RGBW, ibox.RGBW})
+	defer b.Close()
+
+	err := b.Color(1, 0x00)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := [][]byte{{0x45, 0x00, 0x55}, {0x40, 0xB0, 0x55}}
+	testExpectPackets(t, pc, expected)
+}
+
+func TestSendCommandCCTBrightness(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	b := testBridge(t, pc, ibox.Zones{ibox.CCT, ibox.CCT, ibox.CCT, ibox.CCT, ibox.CCT})
+	defer b.Close()
+
+	err := b.Brightness(2, 0x20)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := [][]byte{{0x3D, 0x00, 0x55}}
+	for i := 0; i < cctSteps; i++ {
+		expected = append(expected, []byte{cctBrightnessDown, 0x00, 0x55})
+	}
+	for i := 0; i < cctSteps/2; i++ {
+		expected = append(expected, []byte{cctBrightnessUp, 0x00, 0x55})
+	}
+	testExpectPackets(t, pc, expected)
+}
+
+func TestSendCommandMaxBrightness(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	b := testBridge(t, pc, ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.CCT, ibox.RGBW, ibox.RGBW})
+	defer b.Close()
+
+	err := b.Brightness(1, models.MaxBrightness)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = b.Brightness(2, models.MaxBrightness)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// RGBW bulb gets the top brightness argument, CCT bulb steps all the way up
+	expected := [][]byte{{0x45, 0x00, 0x55}, {rgbwBrightness, maxBrightness, 0x55}, {0x3D, 0x00, 0x55}}
+	for i := 0; i < cctSteps; i++ {
+		expected = append(expected, []byte{cctBrightnessDown, 0x00, 0x55})
+	}
+	for i := 0; i < cctSteps; i++ {
+		expected = append(expected, []byte{cctBrightnessUp, 0x00, 0x55})
+	}
+	testExpectPackets(t, pc, expected)
+}
+
+func TestSendCommandAllZones(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	b := testBridge(t, pc, ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.CCT, ibox.RGBW, ibox.CCT})
+	defer b.Close()
+
+	err := b.Off(ZoneAll)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := [][]byte{{0x41, 0x00, 0x55}, {0x39, 0x00, 0x55}}
+	testExpectPackets(t, pc, expected)
+}
+
+func TestSendCommandUnsupported(t *testing.T) {
+	pc := testListen(t)
+	defer pc.Close()
+
+	b := testBridge(t, pc, ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.CCT, ibox.RGBW, ibox.RGBW})
+	defer b.Close()
+
+	err := b.Color(2, 0x10)
+	if err != ErrUnsupportedCommand {
+		t.Errorf("expected %v, got %v", ErrUnsupportedCommand, err)
+	}
+
+	err = b.Mode(1, 1)
+	if err != ErrUnsupportedCommand {
+		t.Errorf("expected %v, got %v", ErrUnsupportedCommand, err)
+	}
+
+	err = b.On(MaxZone + 1)
+	if err != ErrInvalidZone {
+		t.Errorf("expected %v, got %v", ErrInvalidZone, err)
+	}
+}
+
+func TestNewBridgeUnsupportedDevice(t *testing.T) {
+	_, err := NewBridge("127.0.0.1", 8899, ibox.Zones{ibox.RGBWW, ibox.RGBWW, ibox.RGBWW, ibox.RGBWW, ibox.RGBWW})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func testListen(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return pc
+}
+
+func testBridge(t *testing.T, pc net.PacketConn, zones ibox.Zones) *Bridge {
+	host, port, err := net.SplitHostPort(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	iPort, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := NewBridge(host, iPort, zones)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return b
+}
+
+func testExpectPackets(t *testing.T, pc net.PacketConn, expected [][]byte) {
+	buffer := make([]byte, 1024)
+	for _, packet := range expected {
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !bytes.Equal(packet, buffer[:n]) {
+			t.Errorf("expected %v, got %v", packet, buffer[:n])
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package simulator implements Mi-Light iBox (v6) bridge simulator with virtual bulbs paired with zones.
+package simulator
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+)
+
+const (
+	createSessionLength int = 27
+	keepAliveLength     int = 8
+	commandLength       int = 22
+)
+
+var (
+	// sessionID is the session identifier given to every client.
+	sessionID = [2]byte{0x98, 0x65}
+	// mac is the simulated bridge MAC address.
+	mac = []byte{0xAC, 0xCF, 0x23, 0xF5, 0x7A, 0xD4}
+)
+
+// Bulb represents state of the virtual bulb paired with the zone.
+type Bulb struct {
+	Device      ibox.DeviceType `json:"device"`
+	Linked      bool            `json:"linked"`
+	On          bool            `json:"on"`
+	Night       bool            `json:"night"`
+	White       bool            `json:"white"`
+	Hue         byte            `json:"hue"`
+	Saturation  byte            `json:"saturation"`
+	Brightness  byte            `json:"brightness"`
+	Temperature byte            `json:"temperature"`
+	Mode        byte            `json:"mode"`
+	Speed       int             `json:"speed"`
+}
+
+// Simulator represents simulated Mi-Light iBox bridge.
+type Simulator struct {
+	conn     net.PacketConn
+	bulbs    [ibox.MaxZone + 1]Bulb
+	commands int
+	mux      sync.Mutex
+}
+
+// Listen returns simulator listening at the given UDP address with bulbs of given types paired with zones.
+func Listen(addr string, zones ibox.Zones) (*Simulator, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := Simulator{
+		conn: conn,
+	}
+	for zone, device := range zones {
+		s.bulbs[zone].Device = device
+		s.bulbs[zone].Linked = zone != int(ibox.ZoneAll)
+	}
+	go s.loop()
+	return &s, nil
+}
+
+// Addr returns simulator network address.
+func (s *Simulator) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close stops simulator.
+func (s *Simulator) Close() error {
+	return s.conn.Close()
+}
+
+// Bulb returns state of the bulb paired with the zone.
+func (s *Simulator) Bulb(zone byte) Bulb {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.bulbs[zone]
+}
+
+// Bulbs returns state of the bulbs paired with all zones, ZoneAll entry is not used.
+func (s *Simulator) Bulbs() []Bulb {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	bulbs := make([]Bulb, len(s.bulbs))
+	copy(bulbs, s.bulbs[:])
+	return bulbs
+}
+
+// Commands returns number of light control commands received.
+func (s *Simulator) Commands() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.commands
+}
+
+// loop is the main processing loop.
+func (s *Simulator) loop() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		resp := s.handle(buf[:n])
+		if resp == nil {
+			continue
+		}
+		_, err = s.conn.WriteTo(resp, addr)
+		if err != nil {
+			log.Printf("simulator: can't respond to %s: %s", addr, err)
+		}
+	}
+}
+
+// handle processes packet and returns the response, invalid packets are not answered.
+func (s *Simulator) handle(packet []byte) []byte {
+	switch {
+	case len(packet) == createSessionLength && packet[0] == 0x20:
+		resp := []byte{0x28, 0x00, 0x00, 0x00, 0x11, 0x00, 0x02}
+		resp = append(resp, mac...)
+		resp = append(resp, 0x69, 0xF0, 0x3C, 0x23, 0x00, 0x01, sessionID[0], sessionID[1], 0x00)
+		return resp
+	case len(packet) == keepAliveLength && packet[0] == 0xD0:
+		if !validSession(packet) {
+			return nil
+		}
+		resp := []byte{0xD8, 0x00, 0x00, 0x00, 0x07}
+		resp = append(resp, mac...)
+		resp = append(resp, 0x01)
+		return resp
+	case len(packet) == commandLength && packet[0] == 0x80:
+		if !validSession(packet) || checksum(packet[10:21]) != packet[21] {
+			return nil
+		}
+		s.apply(packet[19], packet[10:19])
+		return []byte{0x88, 0x00, 0x00, 0x00, 0x03, 0x00, packet[8], 0x00}
+	}
+	return nil
+}
+
+// apply applies command to the bulbs paired with the zone, bulbs of other types ignore it.
+func (s *Simulator) apply(zone byte, cmd []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.commands++
+	if zone > ibox.MaxZone {
+		return
+	}
+	zones := []byte{zone}
+	if zone == ibox.ZoneAll {
+		zones = []byte{1, 2, 3, 4}
+	}
+	device := ibox.DeviceType(cmd[3])
+	for _, z := range zones {
+		b := &s.bulbs[z]
+		if b.Device != device {
+			continue
+		}
+		switch cmd[0] {
+		case 0x3D:
+			b.Linked = true
+		case 0x3E:
+			b.Linked = false
+		case 0x31:
+			if b.Linked {
+				apply(b, cmd[4], cmd[5])
+			}
+		}
+	}
+}
+
+// apply applies light control command with the argument to the bulb, color and brightness commands end night light.
+func apply(b *Bulb, cmd, arg byte) {
+	switch b.Device {
+	case ibox.BridgeLamp:
+		switch cmd {
+		case 0x03:
+			switchCommand(b, arg, 0x03, 0x04, 0x00, 0x05, 0x02, 0x01)
+		case 0x01:
+			b.Hue, b.White, b.Night = arg, false, false
+		case 0x02:
+			b.Brightness, b.Night = arg, false
+		case 0x04:
+			b.Mode = arg
+		}
+	case ibox.CCT:
+		switch cmd {
+		case 0x01:
+			switchCommand(b, arg, 0x07, 0x08, 0x06, 0x00, 0x00, 0x00)
+		case 0x02:
+			b.Brightness, b.Night = arg, false
+		case 0x03:
+			b.Temperature, b.Night = arg, false
+		}
+	case ibox.RGBW:
+		switch cmd {
+		case 0x03:
+			switchCommand(b, arg, 0x01, 0x02, 0x06, 0x05, 0x03, 0x04)
+		case 0x01:
+			b.Hue, b.White, b.Night = arg, false, false
+		case 0x02:
+			b.Brightness, b.Night = arg, false
+		case 0x04:
+			b.Mode = arg
+		}
+	case ibox.RGBWW:
+		switch cmd {
+		case 0x04:
+			switchCommand(b, arg, 0x01, 0x02, 0x05, 0x00, 0x03, 0x04)
+		case 0x01:
+			b.Hue, b.White, b.Night = arg, false, false
+		case 0x02:
+			b.Saturation = arg
+		case 0x03:
+			b.Brightness, b.Night = arg, false
+		case 0x05:
+			b.Temperature, b.White, b.Night = arg, true, false
+		case 0x06:
+			b.Mode = arg
+		}
+	}
+}
+
+// switchCommand applies switch command with the argument to the bulb, zero codes are not supported by the bulb.
+func switchCommand(b *Bulb, arg, on, off, night, white, speedUp, speedDown byte) {
+	if arg == 0 {
+		return
+	}
+	switch arg {
+	case on:
+		b.On, b.Night = true, false
+	case off:
+		b.On, b.Night = false, false
+	case night:
+		b.On, b.Night = true, true
+	case white:
+		b.White, b.Night = true, false
+	case speedUp:
+		b.Speed++
+	case speedDown:
+		b.Speed--
+	}
+}
+
+// validSession checks whether packet belongs to the session.
+func validSession(packet []byte) bool {
+	return bytes.Equal(packet[5:7], sessionID[:])
+}
+
+// checksum calculates checksum of the command packet.
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
@@ -0,0 +1,169 @@
+package simulator
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/sgrzywna/milight"
+	"github.com/sgrzywna/milightd/internal/pkg/ibox"
+)
+
+func TestSimulatorBridge(t *testing.T) {
+	zones := ibox.Zones{ibox.RGBWW, ibox.RGBWW, ibox.RGBW, ibox.CCT, ibox.RGBWW}
+
+	s := testSimulator(t, zones)
+	defer s.Close()
+
+	b := testBridge(t, s, zones)
+	defer b.Close()
+
+	for _, err := range []error{
+		b.On(1),
+		b.Color(1, milight.Blue),
+		b.Brightness(1, 0x20),
+		b.Night(2),
+		b.Temperature(3, 0x10),
+		b.Saturation(4, 0x30),
+		b.SpeedUp(4),
+	} {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	expected := []Bulb{
+		{Device: ibox.RGBWW},
+		{Device: ibox.RGBWW, Linked: true, On: true, Hue: milight.Blue, Brightness: 0x20},
+		{Device: ibox.RGBW, Linked: true, On: true, Night: true},
+		{Device: ibox.CCT, Linked: true, Temperature: 0x10},
+		{Device: ibox.RGBWW, Linked: true, Saturation: 0x30, Speed: 1},
+	}
+	for zone, bulb := range s.Bulbs() {
+		if bulb != expected[zone] {
+			t.Errorf("zone %d: expected %+v, got %+v", zone, expected[zone], bulb)
+		}
+	}
+
+	if s.Commands() != 7 {
+		t.Errorf("expected %d commands, got %d", 7, s.Commands())
+	}
+}
+
+func TestSimulatorNightEnd(t *testing.T) {
+	zones := ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.RGBWW, ibox.CCT, ibox.RGBWW}
+
+	s := testSimulator(t, zones)
+	defer s.Close()
+
+	b := testBridge(t, s, zones)
+	defer b.Close()
+
+	for _, err := range []error{
+		b.Night(1),
+		b.Color(1, milight.Red),
+		b.Night(2),
+		b.Brightness(2, 0x20),
+		b.Night(3),
+		b.Temperature(3, 0x10),
+	} {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	for zone := byte(1); zone <= 3; zone++ {
+		if s.Bulb(zone).Night {
+			t.Errorf("zone %d: expected night light ended, got %+v", zone, s.Bulb(zone))
+		}
+	}
+}
+
+func TestSimulatorAllZones(t *testing.T) {
+	zones := ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.CCT, ibox.RGBW, ibox.CCT}
+
+	s := testSimulator(t, zones)
+	defer s.Close()
+
+	b := testBridge(t, s, zones)
+	defer b.Close()
+
+	err := b.On(ibox.ZoneAll)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for zone := byte(1); zone <= ibox.MaxZone; zone++ {
+		if !s.Bulb(zone).On {
+			t.Errorf("zone %d: expected bulb on", zone)
+		}
+	}
+}
+
+func TestSimulatorLink(t *testing.T) {
+	zones := ibox.Zones{ibox.RGBW, ibox.RGBW, ibox.RGBW, ibox.RGBW, ibox.RGBW}
+
+	s := testSimulator(t, zones)
+	defer s.Close()
+
+	b := testBridge(t, s, zones)
+	defer b.Close()
+
+	for _, err := range []error{b.Unlink(2), b.On(2)} {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if bulb := s.Bulb(2); bulb.Linked || bulb.On {
+		t.Errorf("expected unlinked bulb ignoring commands, got %+v", bulb)
+	}
+
+	for _, err := range []error{b.Link(2), b.On(2)} {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if bulb := s.Bulb(2); !bulb.Linked || !bulb.On {
+		t.Errorf("expected linked bulb turned on, got %+v", bulb)
+	}
+}
+
+func TestSimulatorKeepAlive(t *testing.T) {
+	s := testSimulator(t, ibox.Zones{})
+	defer s.Close()
+
+	b := testBridge(t, s, ibox.Zones{})
+	defer b.Close()
+
+	err := b.KeepAlive()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func testSimulator(t *testing.T, zones ibox.Zones) *Simulator {
+	s, err := Listen("127.0.0.1:0", zones)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return s
+}
+
+func testBridge(t *testing.T, s *Simulator, zones ibox.Zones) *ibox.Bridge {
+	host, port, err := net.SplitHostPort(s.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	iPort, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ibox.NewBridge(host, iPort, zones)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return b
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"time"
 
@@ -13,23 +14,68 @@ import (
 
 // Client represents HTTP client for the milightd daemon.
 type Client struct {
-	url    string
-	client *http.Client
+	url      string
+	sync     bool
+	priority string
+	client   *http.Client
+}
+
+// Option represents Client option.
+type Option func(*Client)
+
+// WithSync makes light control commands wait for execution and report device errors.
+func WithSync() Option {
+	return func(c *Client) {
+		c.sync = true
+	}
+}
+
+// WithPriority sets priority of light control commands, models.PriorityAlert doesn't stop the running sequence.
+func WithPriority(priority string) Option {
+	return func(c *Client) {
+		c.priority = priority
+	}
+}
+
+// ResponseError represents structured error reported by milightd daemon.
+type ResponseError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+// Error implements error interface.
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("milightd client: %s (%d): %s", e.Code, e.StatusCode, e.Message)
 }
 
 // NewClient returns initialized Client object.
-func NewClient(url string) *Client {
-	return &Client{
+func NewClient(url string, opts ...Option) *Client {
+	c := Client{
 		url: url,
 		client: &http.Client{
-			Timeout: time.Second * 10,
+			Timeout: time.Second * 20,
 		},
 	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
 }
 
 // SetLight controls mi-light device through milightd daemon.
 func (c *Client) SetLight(l models.Light) error {
 	url := fmt.Sprintf("%s/api/v1/light", c.url)
+	query := neturl.Values{}
+	if c.sync {
+		query.Set("sync", "true")
+	}
+	if c.priority != "" {
+		query.Set("priority", c.priority)
+	}
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
 
 	data, err := json.Marshal(l)
 	if err != nil {
@@ -50,13 +96,224 @@ func (c *Client) SetLight(l models.Light) error {
 
 	defer resp.Body.Close()
 
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusServiceUnavailable:
+		var e models.Error
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		if err != nil {
+			return fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
+		}
+		return &ResponseError{StatusCode: resp.StatusCode, Code: e.Code, Message: e.Message}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetLight returns state of the light in zones paired with the default bridge from milightd daemon.
+func (c *Client) GetLight() ([]models.LightState, error) {
+	return c.GetBridgeLight("")
+}
+
+// GetBridgeLight returns state of the light in zones paired with the named bridge from milightd daemon.
+func (c *Client) GetBridgeLight(bridge string) ([]models.LightState, error) {
+	url := fmt.Sprintf("%s/api/v1/light", c.url)
+	if bridge != "" {
+		url = fmt.Sprintf("%s?bridge=%s", url, neturl.QueryEscape(bridge))
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var states []models.LightState
+
+	err = json.NewDecoder(resp.Body).Decode(&states)
+	if err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+// GetBridges returns status of all bridge connections from milightd daemon.
+func (c *Client) GetBridges() ([]models.BridgeStatus, error) {
+	url := fmt.Sprintf("%s/api/v1/diagnostics/bridges", c.url)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var statuses []models.BridgeStatus
+
+	err = json.NewDecoder(resp.Body).Decode(&statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// Ready returns result of the milightd readiness checks, including the failed ones.
+func (c *Client) Ready() (*models.Health, error) {
+	url := fmt.Sprintf("%s/readyz", c.url)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var health models.Health
+
+	err = json.NewDecoder(resp.Body).Decode(&health)
+	if err != nil {
+		return nil, err
+	}
+
+	return &health, nil
+}
+
+// GetFailedCommands returns the latest commands never executed by the named bridge, or by all bridges when name is empty.
+func (c *Client) GetFailedCommands(bridge string) ([]models.FailedCommand, error) {
+	url := fmt.Sprintf("%s/api/v1/diagnostics/failed-commands", c.url)
+	if bridge != "" {
+		url = fmt.Sprintf("%s?bridge=%s", url, neturl.QueryEscape(bridge))
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var commands []models.FailedCommand
+
+	err = json.NewDecoder(resp.Body).Decode(&commands)
+	if err != nil {
+		return nil, err
+	}
+
+	return commands, nil
+}
+
+// LinkZone pairs bulbs with the zone through milightd daemon.
+func (c *Client) LinkZone(zone int, l models.Link) error {
+	return c.link(zone, "link", l)
+}
+
+// UnlinkZone unpairs bulbs from the zone through milightd daemon.
+func (c *Client) UnlinkZone(zone int, l models.Link) error {
+	return c.link(zone, "unlink", l)
+}
+
+// link sends zone pairing command to milightd daemon.
+func (c *Client) link(zone int, action string, l models.Link) error {
+	url := fmt.Sprintf("%s/api/v1/zones/%d/%s", c.url, zone, action)
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
 		return fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
 	}
 
 	return nil
 }
 
+// GetDevices returns description of the bulbs paired with Mi-Light bridges from milightd daemon.
+func (c *Client) GetDevices() ([]models.Device, error) {
+	url := fmt.Sprintf("%s/api/v1/devices", c.url)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("milightd client: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var devices []models.Device
+
+	err = json.NewDecoder(resp.Body).Decode(&devices)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
 // GetSequences returns list of defined sequences from milightd daemon.
 func (c *Client) GetSequences() ([]models.Sequence, error) {
 	url := fmt.Sprintf("%s/api/v1/sequence", c.url)
@@ -172,9 +429,17 @@ func (c *Client) DeleteSequence(name string) error {
 	return nil
 }
 
-// GetSequenceState returns state of the running sequence from milightd daemon.
+// GetSequenceState returns state of the sequence running on the default bridge from milightd daemon.
 func (c *Client) GetSequenceState() (*models.SequenceState, error) {
+	return c.GetBridgeSequenceState("")
+}
+
+// GetBridgeSequenceState returns state of the sequence running on the named bridge from milightd daemon.
+func (c *Client) GetBridgeSequenceState(bridge string) (*models.SequenceState, error) {
 	url := fmt.Sprintf("%s/api/v1/seqctrl", c.url)
+	if bridge != "" {
+		url = fmt.Sprintf("%s?bridge=%s", url, neturl.QueryEscape(bridge))
+	}
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -231,3 +496,23 @@ func (c *Client) SetSequenceState(state models.SequenceState) error {
 
 	return nil
 }
+
+// StartSequenceAt starts the sequence on the bridge at the offset in milliseconds from its beginning.
+func (c *Client) StartSequenceAt(bridge, name string, offset int) error {
+	return c.SetSequenceState(models.SequenceState{Bridge: bridge, Name: name, State: models.SeqRunning, Offset: offset})
+}
+
+// SeekSequence jumps to the step of the sequence running on the bridge.
+func (c *Client) SeekSequence(bridge string, step int) error {
+	return c.SetSequenceState(models.SequenceState{Bridge: bridge, Action: models.SeqSeek, Step: &step})
+}
+
+// NextSequenceStep jumps to the next step of the sequence running on the bridge.
+func (c *Client) NextSequenceStep(bridge string) error {
+	return c.SetSequenceState(models.SequenceState{Bridge: bridge, Action: models.SeqNext})
+}
+
+// PreviousSequenceStep jumps to the previous step of the sequence running on the bridge.
+func (c *Client) PreviousSequenceStep(bridge string) error {
+	return c.SetSequenceState(models.SequenceState{Bridge: bridge, Action: models.SeqPrevious})
+}
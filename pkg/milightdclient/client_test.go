@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/sgrzywna/milightd/pkg/models"
 )
@@ -27,8 +28,30 @@ func TestSetLight(t *testing.T) {
 	// just switch
 	l4 := models.Light{}
 	l4.SetSwitch(true)
-
-	cases := []models.Light{l0, l1, l2, l3, l4}
+	// switch in zone
+	l5 := models.Light{}
+	l5.SetZone(2)
+	l5.SetSwitch(true)
+	// switch on bridge
+	l6 := models.Light{}
+	l6.SetBridge("kitchen")
+	l6.SetSwitch(true)
+
+	// white temperature and saturation
+	l7 := models.Light{}
+	l7.SetKelvin(4000)
+	l7.SetSaturation(50)
+
+	// effect mode with speed
+	l8 := models.Light{}
+	l8.SetMode(5)
+	l8.SetSpeed(true)
+
+	// night light
+	l9 := models.Light{}
+	l9.SetNight()
+
+	cases := []models.Light{l0, l1, l2, l3, l4, l5, l6, l7, l8, l9}
 
 	var expected models.Light
 
@@ -112,6 +135,147 @@ var (
 	}
 )
 
+func TestSetLightSync(t *testing.T) {
+	var query string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusGatewayTimeout)
+		json.NewEncoder(w).Encode(models.Error{Code: models.ErrorBridgeTimeout, Message: "bridge timeout"})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithSync(), WithPriority(models.PriorityAlert))
+
+	l := models.Light{}
+	l.SetSwitch(true)
+
+	err := c.SetLight(l)
+
+	if query != "priority=alert&sync=true" {
+		t.Errorf("expected %s, got %s", "priority=alert&sync=true", query)
+	}
+
+	e, ok := err.(*ResponseError)
+	if !ok {
+		t.Fatalf("expected *ResponseError, got %v", err)
+	}
+
+	expected := ResponseError{StatusCode: http.StatusGatewayTimeout, Code: models.ErrorBridgeTimeout, Message: "bridge timeout"}
+	if *e != expected {
+		t.Errorf("expected %v, got %v", expected, *e)
+	}
+}
+
+func TestGetLight(t *testing.T) {
+	on := models.On
+	states := []models.LightState{
+		{Bridge: "kitchen", Zone: 1, Switch: &on},
+		{Bridge: "kitchen", Zone: 2},
+	}
+
+	var query string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		err := json.NewEncoder(w).Encode(states)
+		if err != nil {
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	ss, err := c.GetBridgeLight("kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query != "bridge=kitchen" {
+		t.Errorf("expected %s, got %s", "bridge=kitchen", query)
+	}
+
+	if !reflect.DeepEqual(states, ss) {
+		t.Errorf("expected %v, got %v", states, ss)
+	}
+}
+
+func TestLinkZone(t *testing.T) {
+	var path string
+	var expected models.Link
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		err := json.NewDecoder(r.Body).Decode(&expected)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	l := models.Link{Bridge: "kitchen", Duration: 3000}
+
+	err := c.LinkZone(2, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v1/zones/2/link" {
+		t.Errorf("expected %s, got %s", "/api/v1/zones/2/link", path)
+	}
+	if l != expected {
+		t.Errorf("expected %v, got %v", l, expected)
+	}
+
+	err = c.UnlinkZone(4, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v1/zones/4/unlink" {
+		t.Errorf("expected %s, got %s", "/api/v1/zones/4/unlink", path)
+	}
+}
+
+func TestGetDevices(t *testing.T) {
+	devices := []models.Device{
+		{
+			Bridge:       "kitchen",
+			Zone:         1,
+			Bulb:         "rgbww",
+			Capabilities: models.Capabilities{Switch: true, Brightness: true, Color: true, Kelvin: true},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		err := json.NewEncoder(w).Encode(devices)
+		if err != nil {
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	dd, err := c.GetDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(devices, dd) {
+		t.Errorf("expected %v, got %v", devices, dd)
+	}
+}
+
 func TestGetSequences(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -226,6 +390,41 @@ func TestGetSequenceState(t *testing.T) {
 	}
 }
 
+func TestGetBridgeSequenceState(t *testing.T) {
+	testState := models.SequenceState{
+		Bridge: "kitchen",
+		Name:   tests[0].Name,
+		State:  models.SeqRunning,
+	}
+
+	var bridge string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bridge = r.URL.Query().Get("bridge")
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		err := json.NewEncoder(w).Encode(testState)
+		if err != nil {
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	seqState, err := c.GetBridgeSequenceState(testState.Bridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bridge != testState.Bridge {
+		t.Errorf("expected %s, got %s", testState.Bridge, bridge)
+	}
+
+	if !reflect.DeepEqual(testState, *seqState) {
+		t.Errorf("expected %v, got %v", testState, *seqState)
+	}
+}
+
 func TestSetSequenceState(t *testing.T) {
 	var expected models.SequenceState
 
@@ -255,3 +454,150 @@ func TestSetSequenceState(t *testing.T) {
 		t.Errorf("expected %v, got %v", expected, testState)
 	}
 }
+
+func TestSequenceControl(t *testing.T) {
+	var received models.SequenceState
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = models.SequenceState{}
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	step := 2
+	var testCases = []struct {
+		name     string
+		call     func() error
+		expected models.SequenceState
+	}{
+		{"start at", func() error { return c.StartSequenceAt("b1", tests[0].Name, 1500) },
+			models.SequenceState{Bridge: "b1", Name: tests[0].Name, State: models.SeqRunning, Offset: 1500}},
+		{"seek", func() error { return c.SeekSequence("b1", 2) },
+			models.SequenceState{Bridge: "b1", Action: models.SeqSeek, Step: &step}},
+		{"next", func() error { return c.NextSequenceStep("b1") },
+			models.SequenceState{Bridge: "b1", Action: models.SeqNext}},
+		{"previous", func() error { return c.PreviousSequenceStep("b1") },
+			models.SequenceState{Bridge: "b1", Action: models.SeqPrevious}},
+	}
+
+	for _, tc := range testCases {
+		err := tc.call()
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if !reflect.DeepEqual(tc.expected, received) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, received)
+		}
+	}
+}
+
+func TestGetFailedCommands(t *testing.T) {
+	failed := []models.FailedCommand{
+		{Bridge: "kitchen", Command: "zone 1 light switch on", Attempts: 3, Error: "can't allocate connection", Time: time.Date(2021, 3, 14, 18, 1, 2, 0, time.UTC)},
+	}
+
+	var path, query string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		err := json.NewEncoder(w).Encode(failed)
+		if err != nil {
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	fc, err := c.GetFailedCommands("kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/api/v1/diagnostics/failed-commands" || query != "bridge=kitchen" {
+		t.Errorf("expected %s?%s, got %s?%s", "/api/v1/diagnostics/failed-commands", "bridge=kitchen", path, query)
+	}
+
+	if !reflect.DeepEqual(failed, fc) {
+		t.Errorf("expected %v, got %v", failed, fc)
+	}
+}
+
+func TestGetBridges(t *testing.T) {
+	statuses := []models.BridgeStatus{
+		{Bridge: "kitchen", Circuit: models.Circuit{State: models.CircuitHalfOpen, Failures: 4, Changed: time.Date(2021, 3, 14, 18, 1, 2, 0, time.UTC)}},
+	}
+
+	var path string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		err := json.NewEncoder(w).Encode(statuses)
+		if err != nil {
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	ss, err := c.GetBridges()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/api/v1/diagnostics/bridges" {
+		t.Errorf("expected %s, got %s", "/api/v1/diagnostics/bridges", path)
+	}
+
+	if !reflect.DeepEqual(statuses, ss) {
+		t.Errorf("expected %v, got %v", statuses, ss)
+	}
+}
+
+func TestReady(t *testing.T) {
+	health := models.Health{Status: models.HealthFailed, Checks: []models.Check{
+		{Name: models.CheckStore, Status: models.HealthOK},
+		{Name: models.CheckLoop, Bridge: "kitchen", Status: models.HealthFailed, Detail: "command stuck for 1m0s"},
+	}}
+
+	var path string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		err := json.NewEncoder(w).Encode(health)
+		if err != nil {
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	h, err := c.Ready()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/readyz" {
+		t.Errorf("expected %s, got %s", "/readyz", path)
+	}
+
+	if !reflect.DeepEqual(&health, h) {
+		t.Errorf("expected %v, got %v", health, *h)
+	}
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 const (
@@ -10,45 +11,160 @@ const (
 	On = "on"
 	// Off turns light off.
 	Off = "off"
+	// Night turns night light on.
+	Night = "night"
+	// SpeedUp increases effect mode speed.
+	SpeedUp = "up"
+	// SpeedDown decreases effect mode speed.
+	SpeedDown = "down"
+	// PriorityInteractive is the priority of interactive light control commands, they stop the running sequence.
+	PriorityInteractive = "interactive"
+	// PriorityAlert is the priority of alerts sent before interactive commands, they don't stop the running sequence.
+	PriorityAlert = "alert"
+	// CircuitClosed represents bridge connection working normally.
+	CircuitClosed = "closed"
+	// CircuitOpen represents bridge connection not tried because of the recent failures.
+	CircuitOpen = "open"
+	// CircuitHalfOpen represents bridge connection probed after the cooldown.
+	CircuitHalfOpen = "half-open"
+	// HealthOK represents passed health check.
+	HealthOK = "ok"
+	// HealthFailed represents failed health check.
+	HealthFailed = "failed"
+	// CheckStore is the name of the check reading the store.
+	CheckStore = "store"
+	// CheckBridge is the name of the check of the recent bridge connection.
+	CheckBridge = "bridge"
+	// CheckLoop is the name of the check of the commands loop progress.
+	CheckLoop = "loop"
 	// SeqRunning represents state of the running sequence.
 	SeqRunning = "running"
 	// SeqStopped represents state of the stopped sequence.
 	SeqStopped = "stopped"
 	// SeqPaused represents state of the paused sequence.
 	SeqPaused = "paused"
+	// SeqCompleted is the reason of the sequence stopped after the last playback.
+	SeqCompleted = "completed"
+	// SeqEndStop stops the light at the last step of the completed sequence.
+	SeqEndStop = "stop"
+	// SeqEndOff switches off zones driven by the completed sequence.
+	SeqEndOff = "off"
+	// SeqEndRestore restores the light state from before the sequence.
+	SeqEndRestore = "restore"
+	// SeqEndChain starts the next sequence after the completed one.
+	SeqEndChain = "chain"
+	// SeqSeek jumps to the step of the running sequence.
+	SeqSeek = "seek"
+	// SeqNext jumps to the next step of the running sequence.
+	SeqNext = "next"
+	// SeqPrevious jumps to the previous step of the running sequence.
+	SeqPrevious = "previous"
+	// ZoneAll addresses all zones.
+	ZoneAll = 0
+	// MaxZone is the highest zone number.
+	MaxZone = 4
+	// MaxBrightness is the maximal brightness level.
+	MaxBrightness = 64
+	// MaxHue is the maximal Mi-Light hue value.
+	MaxHue = 255
+	// MaxSaturation is the maximal color saturation level.
+	MaxSaturation = 100
+	// MinMode is the first built-in effect mode.
+	MinMode = 1
+	// MaxMode is the last built-in effect mode.
+	MaxMode = 9
 )
 
 // Sequence represents light control sequence.
 type Sequence struct {
 	Name  string         `json:"name"`
 	Steps []SequenceStep `json:"steps"`
+	// Repeat is the number of sequence playbacks, sequence loops endlessly when 0.
+	Repeat int `json:"repeat,omitempty"`
+	// End is the action done after the last playback, the light stays at the last step when empty.
+	End string `json:"end,omitempty"`
+	// Next is the name of the sequence started with the chain end action.
+	Next string `json:"next,omitempty"`
 }
 
 // SequenceStep represents single step from the light control sequence.
 type SequenceStep struct {
 	Light    Light `json:"light"`
 	Duration int   `json:"duration"`
+	// Transition is the time in milliseconds hue and brightness fade into the step at its beginning, part of the duration.
+	Transition int `json:"transition,omitempty"`
 }
 
 // Light represents command to control light.
 type Light struct {
+	Bridge     string  `json:"bridge"`
+	Zone       int     `json:"zone"`
 	Color      *string `json:"color"`
+	Hue        *int    `json:"hue"`
+	Saturation *int    `json:"saturation"`
+	Kelvin     *int    `json:"kelvin"`
 	Brightness *int    `json:"brightness"`
+	Mode       *int    `json:"mode"`
+	Speed      *string `json:"speed"`
 	Switch     *string `json:"switch"`
 }
 
+// SetBridge sets addressed bridge name.
+func (l *Light) SetBridge(bridge string) {
+	l.Bridge = bridge
+}
+
+// SetZone sets addressed zone.
+func (l *Light) SetZone(zone int) {
+	l.Zone = zone
+}
+
 // SetColor sets color name.
 func (l *Light) SetColor(color string) {
 	l.Color = new(string)
 	*l.Color = color
 }
 
+// SetHue sets Mi-Light hue value.
+func (l *Light) SetHue(hue int) {
+	l.Hue = new(int)
+	*l.Hue = hue
+}
+
+// SetSaturation sets color saturation.
+func (l *Light) SetSaturation(saturation int) {
+	l.Saturation = new(int)
+	*l.Saturation = saturation
+}
+
+// SetKelvin sets white light temperature.
+func (l *Light) SetKelvin(kelvin int) {
+	l.Kelvin = new(int)
+	*l.Kelvin = kelvin
+}
+
 // SetBrightness sets light brightness.
 func (l *Light) SetBrightness(brightness int) {
 	l.Brightness = new(int)
 	*l.Brightness = brightness
 }
 
+// SetMode sets built-in effect mode.
+func (l *Light) SetMode(mode int) {
+	l.Mode = new(int)
+	*l.Mode = mode
+}
+
+// SetSpeed changes effect mode speed.
+func (l *Light) SetSpeed(faster bool) {
+	l.Speed = new(string)
+	if faster {
+		*l.Speed = SpeedUp
+	} else {
+		*l.Speed = SpeedDown
+	}
+}
+
 // SetSwitch sets light state.
 func (l *Light) SetSwitch(state bool) {
 	l.Switch = new(string)
@@ -59,26 +175,66 @@ func (l *Light) SetSwitch(state bool) {
 	}
 }
 
+// SetNight turns night light on.
+func (l *Light) SetNight() {
+	l.Switch = new(string)
+	*l.Switch = Night
+}
+
 // Clear sets all attributes to their zero values.
 func (l *Light) Clear() {
+	l.Bridge = ""
+	l.Zone = ZoneAll
 	l.Color = nil
+	l.Hue = nil
+	l.Saturation = nil
+	l.Kelvin = nil
 	l.Brightness = nil
+	l.Mode = nil
+	l.Speed = nil
 	l.Switch = nil
 }
 
 // String implements string representation for the Light structure.
 func (l *Light) String() string {
 	var items []string
+	items = append(items, fmt.Sprintf("bridge:%s", l.Bridge))
+	items = append(items, fmt.Sprintf("zone:%d", l.Zone))
 	if l.Color != nil {
 		items = append(items, fmt.Sprintf("color:%s", *l.Color))
 	} else {
 		items = append(items, "color:nil")
 	}
+	if l.Hue != nil {
+		items = append(items, fmt.Sprintf("hue:%d", *l.Hue))
+	} else {
+		items = append(items, "hue:nil")
+	}
+	if l.Saturation != nil {
+		items = append(items, fmt.Sprintf("saturation:%d", *l.Saturation))
+	} else {
+		items = append(items, "saturation:nil")
+	}
+	if l.Kelvin != nil {
+		items = append(items, fmt.Sprintf("kelvin:%d", *l.Kelvin))
+	} else {
+		items = append(items, "kelvin:nil")
+	}
 	if l.Brightness != nil {
 		items = append(items, fmt.Sprintf("brightness:%d", *l.Brightness))
 	} else {
 		items = append(items, "brightness:nil")
 	}
+	if l.Mode != nil {
+		items = append(items, fmt.Sprintf("mode:%d", *l.Mode))
+	} else {
+		items = append(items, "mode:nil")
+	}
+	if l.Speed != nil {
+		items = append(items, fmt.Sprintf("speed:%s", *l.Speed))
+	} else {
+		items = append(items, "speed:nil")
+	}
 	if l.Switch != nil {
 		items = append(items, fmt.Sprintf("switch:%s", *l.Switch))
 	} else {
@@ -87,8 +243,141 @@ func (l *Light) String() string {
 	return strings.Join(items, ",")
 }
 
+// Capabilities describes light control features supported by the device.
+type Capabilities struct {
+	Switch     bool `json:"switch"`
+	Brightness bool `json:"brightness"`
+	Color      bool `json:"color"`
+	White      bool `json:"white"`
+	Saturation bool `json:"saturation"`
+	Kelvin     bool `json:"kelvin"`
+	Modes      bool `json:"modes"`
+	Night      bool `json:"night"`
+	Link       bool `json:"link"`
+}
+
+// Device describes bulbs paired with the bridge zone.
+type Device struct {
+	Bridge       string       `json:"bridge"`
+	Zone         int          `json:"zone"`
+	Bulb         string       `json:"bulb"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// Link represents command to pair or unpair bulbs with the zone.
+type Link struct {
+	Bridge   string `json:"bridge"`
+	Duration int    `json:"duration"`
+}
+
+// LightState represents tracked state of the light in the zone, nil fields were never set.
+type LightState struct {
+	Bridge     string       `json:"bridge"`
+	Zone       int          `json:"zone"`
+	Switch     *string      `json:"switch"`
+	Color      *string      `json:"color"`
+	Hue        *int         `json:"hue"`
+	Brightness *int         `json:"brightness"`
+	Changed    StateChanges `json:"changed"`
+	LastSend   *SendStatus  `json:"lastSend"`
+}
+
+// StateChanges represents time of the last change of every light state field.
+type StateChanges struct {
+	Switch     *time.Time `json:"switch,omitempty"`
+	Color      *time.Time `json:"color,omitempty"`
+	Hue        *time.Time `json:"hue,omitempty"`
+	Brightness *time.Time `json:"brightness,omitempty"`
+}
+
+// SendStatus represents result of the last command sent to the zone.
+type SendStatus struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// BridgeStatus represents status of the bridge connection.
+type BridgeStatus struct {
+	Bridge  string  `json:"bridge"`
+	Circuit Circuit `json:"circuit"`
+}
+
+// Circuit represents state of the bridge connection circuit breaker.
+type Circuit struct {
+	State    string    `json:"state"`
+	Failures int       `json:"failures"`
+	Changed  time.Time `json:"changed"`
+}
+
+// FailedCommand represents command never executed by the bridge.
+type FailedCommand struct {
+	Bridge   string    `json:"bridge"`
+	Command  string    `json:"command"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// Health represents result of the health checks.
+type Health struct {
+	Status string  `json:"status"`
+	Checks []Check `json:"checks,omitempty"`
+}
+
+// Check represents result of the single health check, bridge is empty for checks not related to any bridge.
+type Check struct {
+	Name   string `json:"name"`
+	Bridge string `json:"bridge,omitempty"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Error codes.
+const (
+	// ErrorBridgeUnavailable reports bridge connection failure or invalid bridge response.
+	ErrorBridgeUnavailable = "bridge_unavailable"
+	// ErrorBridgeTimeout reports bridge not responding in time.
+	ErrorBridgeTimeout = "bridge_timeout"
+	// ErrorBridgeBusy reports command not queued for execution in time.
+	ErrorBridgeBusy = "bridge_busy"
+)
+
+// Error represents error response.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 // SequenceState represents sequence state.
 type SequenceState struct {
-	Name  string `json:"name"`
-	State string `json:"state"`
+	Bridge string `json:"bridge"`
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	// Reason tells why the sequence stopped, it's set only for the completed sequence.
+	Reason string `json:"reason,omitempty"`
+	// Progress is set for the running and paused sequence.
+	Progress *SequenceProgress `json:"progress,omitempty"`
+	// Action controls playback of the running sequence instead of its state.
+	Action string `json:"action,omitempty"`
+	// Step is the index of the step the seek action jumps to.
+	Step *int `json:"step,omitempty"`
+	// Offset is the time in milliseconds from the beginning of the sequence started with the running state.
+	Offset int `json:"offset,omitempty"`
+}
+
+// SequenceProgress represents progress of the sequence playback, durations are in milliseconds.
+type SequenceProgress struct {
+	// Step is the index of the current step.
+	Step int `json:"step"`
+	// StepStarted is the time the current step started.
+	StepStarted time.Time `json:"stepStarted"`
+	// StepRemaining is the time until the next step, it doesn't pass while the sequence is paused.
+	StepRemaining int `json:"stepRemaining"`
+	// Iteration is the current playback of the sequence, counted from 1.
+	Iteration int `json:"iteration"`
+	// CycleDuration is the duration of all sequence steps.
+	CycleDuration int `json:"cycleDuration"`
+	// Started is the time the sequence started.
+	Started time.Time `json:"started"`
 }